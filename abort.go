@@ -0,0 +1,51 @@
+package httplog
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+// StatusClientClosedRequest is the non-standard status used by NGINX to
+// report that the client closed the connection before the response was
+// complete.
+const StatusClientClosedRequest = 499
+
+// MiddlewareOptionAbortStatus replaces the status field of the access log
+// with the given code when the client disconnected before the response was
+// complete. StatusClientClosedRequest matches the NGINX convention. By default
+// the status written by the handler is logged unchanged.
+func MiddlewareOptionAbortStatus(code int) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.abortStatus = code
+		return m
+	}
+}
+
+// recordAbort marks the access log when the client went away while the
+// request was being handled. The write_error and client_aborted fields are
+// only added when they apply.
+func (m *Middleware) recordAbort(a *Access, fields map[string]interface{}, r *http.Request, writeErr error) {
+	if writeErr != nil {
+		fields["write_error"] = writeErr.Error()
+	}
+	if !errors.Is(r.Context().Err(), context.Canceled) && !isDisconnect(writeErr) {
+		return
+	}
+	fields["client_aborted"] = true
+	if m.abortStatus != 0 {
+		a.Status = m.abortStatus
+	}
+}
+
+// isDisconnect reports whether a write error was caused by the client closing
+// the connection.
+func isDisconnect(err error) bool {
+	return err != nil && (errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe))
+}
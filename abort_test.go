@@ -0,0 +1,90 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"syscall"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureFailingResponseWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (r fixtureFailingResponseWriter) Write(b []byte) (int, error) {
+	return 0, r.err
+}
+
+type fixtureHandlerAbort struct {
+	cancel context.CancelFunc
+}
+
+func (h fixtureHandlerAbort) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.cancel != nil {
+		h.cancel()
+	}
+	_, _ = w.Write([]byte(`partial`))
+}
+
+func TestMiddlewareClientAbort(t *testing.T) {
+	var disconnect = &net.OpError{Op: "write", Net: "tcp", Err: syscall.EPIPE}
+	var tc = []struct {
+		name            string
+		cancel          bool
+		writeErr        error
+		expectedAborted bool
+		expectedStatus  int
+	}{
+		{"completed", false, nil, false, http.StatusOK},
+		{"context canceled", true, nil, true, StatusClientClosedRequest},
+		{"broken pipe", false, disconnect, true, StatusClientClosedRequest},
+		{"handler error", false, http.ErrBodyNotAllowed, false, http.StatusOK},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var logger = NewMockLogger(ctrl)
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			var handler = fixtureHandlerAbort{}
+			if c.cancel {
+				handler.cancel = cancel
+			}
+			var m = NewMiddleware(MiddlewareOptionAbortStatus(StatusClientClosedRequest))(handler).(*Middleware)
+			var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``))).WithContext(ctx)
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+			req = req.WithContext(logevent.NewContext(req.Context(), logger))
+			var w http.ResponseWriter = httptest.NewRecorder()
+			if c.writeErr != nil {
+				w = fixtureFailingResponseWriter{httptest.NewRecorder(), c.writeErr}
+			}
+
+			var accessLogger, fields = expectAccessFields(ctrl, logger)
+			accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+				if evt := event.(Access); evt.Status != c.expectedStatus {
+					t.Fatalf("unexpected status, %v", evt)
+				}
+			})
+			m.ServeHTTP(w, req)
+			if aborted := fields["client_aborted"] == true; aborted != c.expectedAborted {
+				t.Fatalf("unexpected abort detection, %v", fields)
+			}
+			if c.writeErr != nil && fields["write_error"] != c.writeErr.Error() {
+				t.Fatalf("write error was not recorded, %v", fields)
+			}
+			if c.writeErr == nil && fields["write_error"] != nil {
+				t.Fatalf("unexpected write error, %v", fields)
+			}
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package httplog
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Authorizer decides whether a request to the admin handler is allowed.
+type Authorizer func(*http.Request) bool
+
+// adminUpdate holds the settings that may be changed through the admin
+// handler. Settings that are absent are left unchanged.
+type adminUpdate struct {
+	Level            *string   `json:"level"`
+	ServerErrorLevel *string   `json:"server_error_level"`
+	SampleRate       *float64  `json:"sample_rate"`
+	DebugRoutes      *[]string `json:"debug_routes"`
+}
+
+// adminHandler serves the settings of a Runtime.
+type adminHandler struct {
+	runtime   *Runtime
+	authorize Authorizer
+	recorder  *Recorder
+}
+
+// NewAdminHandler returns a handler for inspecting and changing the settings
+// of the Runtime. It serves the following paths relative to where it is
+// mounted, for example with http.StripPrefix:
+//
+//	GET /config    the effective configuration, with secrets masked
+//	PUT /config    update level, server_error_level, sample_rate, or debug_routes
+//	GET /requests  the access records held by the recorder, oldest first
+//
+// Every request must be allowed by the authorizer because the configuration
+// and recorded requests may be sensitive. A nil authorizer denies every
+// request. Updates are audited as ConfigChange events with the admin source.
+// The recorder may be nil if none is installed with MiddlewareOptionRecorder.
+func NewAdminHandler(rt *Runtime, authorize Authorizer, recorder *Recorder) http.Handler {
+	return &adminHandler{runtime: rt, authorize: authorize, recorder: recorder}
+}
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorize == nil || !h.authorize(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	switch strings.TrimSuffix(r.URL.Path, "/") {
+	case "/config", "config":
+		switch r.Method {
+		case http.MethodGet:
+			h.writeConfig(w)
+		case http.MethodPut, http.MethodPatch:
+			h.updateConfig(w, r)
+		default:
+			w.Header().Set("Allow", "GET, PUT, PATCH")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	case "/requests", "requests":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", "GET")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		h.writeRequests(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *adminHandler) writeConfig(w http.ResponseWriter) {
+	writeJSON(w, middlewareConfig(h.runtime.current.Load()))
+}
+
+func (h *adminHandler) updateConfig(w http.ResponseWriter, r *http.Request) {
+	var update adminUpdate
+	var decoder = json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&update); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var err = h.runtime.update(ConfigSourceAdmin, func(conf *Config) {
+		if update.Level != nil {
+			conf.Level = *update.Level
+		}
+		if update.ServerErrorLevel != nil {
+			conf.ServerErrorLevel = *update.ServerErrorLevel
+		}
+		if update.SampleRate != nil {
+			conf.SampleRate = *update.SampleRate
+		}
+		if update.DebugRoutes != nil {
+			conf.DebugRoutes = *update.DebugRoutes
+		}
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.writeConfig(w)
+}
+
+func (h *adminHandler) writeRequests(w http.ResponseWriter) {
+	var records = []map[string]interface{}{}
+	if h.recorder != nil {
+		for _, record := range h.recorder.Records() {
+			records = append(records, recordFields(record))
+		}
+	}
+	writeJSON(w, records)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	var encoder = json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(value)
+}
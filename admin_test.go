@@ -0,0 +1,130 @@
+package httplog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestAdminHandlerConfig(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var conf = NewConfig()
+	conf.Service = "test"
+	conf.Tags = map[string]string{"api_key": "hunter2"}
+	var rt, _ = NewRuntime(conf, logger)
+
+	var admin = NewAdminHandler(rt, func(r *http.Request) bool {
+		return r.Header.Get("Authorization") == "Bearer admin"
+	}, nil)
+	var w = httptest.NewRecorder()
+	var req = httptest.NewRequest(http.MethodGet, "/config", nil)
+	req.Header.Set("Authorization", "Bearer admin")
+	admin.ServeHTTP(w, req)
+	var effective map[string]string
+	if err := json.Unmarshal(w.Body.Bytes(), &effective); err != nil {
+		t.Fatal(err)
+	}
+	if effective["service"] != "test" || effective["tag.api_key"] != "REDACTED" || effective["tls_verbosity"] != "basic" {
+		t.Fatalf("unexpected configuration %v", effective)
+	}
+	w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"level": "debug"}`)))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("expected an unauthorized update to be forbidden but got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"sample_rate": 2}`))
+	req.Header.Set("Authorization", "Bearer admin")
+	logger.EXPECT().Error(gomock.Any())
+	admin.ServeHTTP(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected an invalid update to be rejected but got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/config", strings.NewReader(`{"level": "warn", "sample_rate": 0.5}`))
+	req.Header.Set("Authorization", "Bearer admin")
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		if evt := event.(ConfigChange); evt.Source != ConfigSourceAdmin || len(evt.Changed) != 2 {
+			t.Fatalf("unexpected change event, %v", evt)
+		}
+	})
+	admin.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || rt.Config().Level != LevelWarn || rt.Config().SampleRate != 0.5 || rt.Config().Service != "test" {
+		t.Fatalf("update was not applied, %d %+v", w.Code, rt.Config())
+	}
+}
+
+func TestAdminHandlerNilAuthorizer(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var rt, _ = NewRuntime(NewConfig(), NewMockLogger(ctrl))
+	var admin = NewAdminHandler(rt, nil, NewRecorder(10))
+	var tc = []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"read config", http.MethodGet, "/config"},
+		{"update config", http.MethodPut, "/config"},
+		{"read requests", http.MethodGet, "/requests"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var w = httptest.NewRecorder()
+			admin.ServeHTTP(w, httptest.NewRequest(c.method, c.path, strings.NewReader(`{"level": "debug"}`)))
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected %s %s to be forbidden but got %d", c.method, c.path, w.Code)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerDebugRoutes(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var conf = NewConfig()
+	conf.SampleRate = 0
+	var recorder = NewRecorder(10)
+	var rt, _ = NewRuntime(conf, logger, MiddlewareOptionRecorder(recorder))
+	var admin = NewAdminHandler(rt, func(*http.Request) bool { return true }, recorder)
+	var handler = rt.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r.Context(), "/users/{id}")
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+
+	logger.EXPECT().Info(gomock.Any())
+	admin.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(`{"debug_routes": ["/users/{id}"]}`)))
+
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		if !evt.Debug || evt.RequestHeaders["X-Forwarded-Proto"] != "https, http" || evt.RequestHeaders["Authorization"] != "REDACTED" {
+			t.Fatalf("debug detail missing, %v", evt)
+		}
+	})
+	var req = newLevelRequest(logger)
+	req.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var w = httptest.NewRecorder()
+	admin.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/requests", nil))
+	var records []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0]["route"] != "/users/{id}" || records[1]["debug"] != true {
+		t.Fatalf("unexpected records %v", records)
+	}
+}
@@ -0,0 +1,325 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tlsVerbosityNames maps the configuration names of the TLS verbosity levels.
+var tlsVerbosityNames = map[string]TLSVerbosity{
+	"none":               TLSVerbosityNone,
+	"basic":              TLSVerbosityBasic,
+	"connection":         TLSVerbosityConnection,
+	"client_certificate": TLSVerbosityClientCertificate,
+}
+
+// tlsVerbosityName returns the configuration name of a TLS verbosity level.
+func tlsVerbosityName(verbosity TLSVerbosity) string {
+	for name, value := range tlsVerbosityNames {
+		if value == verbosity {
+			return name
+		}
+	}
+	return strconv.Itoa(int(verbosity))
+}
+
+// baseProviderNames maps the configuration names of the Base providers.
+var baseProviderNames = map[string]func() BaseProvider{
+	"build_info":  BaseFromBuildInfo,
+	"environment": BaseFromEnvironment,
+	"kubernetes":  BaseFromKubernetes,
+	"container":   BaseFromContainer,
+}
+
+// Config describes the middleware options that can be expressed as plain
+// values. It can be loaded from environment variables or a file and turned
+// into options with Options. Options that take functions, such as
+// MiddlewareOptionTagFunc, must still be given in code.
+type Config struct {
+	Service          string            `json:"service" yaml:"service" description:"Name of the service."`
+	Version          string            `json:"version" yaml:"version" description:"Version of the service."`
+	Host             string            `json:"host" yaml:"host" description:"Host name of the service. Defaults to the machine host name."`
+	Env              string            `json:"env" yaml:"env" description:"Environment of the service."`
+	BaseProviders    []string          `json:"base_providers" yaml:"base_providers" description:"Base providers applied before the values above: build_info, environment, kubernetes, container."`
+	Tags             map[string]string `json:"tags" yaml:"tags" description:"Static key/value pairs added to every log."`
+	RedactParameters []string          `json:"redact_parameters" yaml:"redact_parameters" description:"Query parameters whose values are redacted."`
+	RequestHeaders   []string          `json:"request_headers" yaml:"request_headers" description:"Request headers recorded in the access log."`
+	Trailers         []string          `json:"trailers" yaml:"trailers" description:"Response trailers recorded in the access log."`
+	SampleRate       float64           `json:"sample_rate" yaml:"sample_rate" description:"Fraction of access logs emitted, between 0 and 1. Server errors are always logged."`
+	DebugRoutes      []string          `json:"debug_routes" yaml:"debug_routes" description:"Routes or paths logged with debug detail and never sampled out."`
+	Level            string            `json:"level" yaml:"level" description:"Level of the access log: debug, info, warn, or error."`
+	ServerErrorLevel string            `json:"server_error_level" yaml:"server_error_level" description:"Level of the access log for 5xx responses."`
+	ServerTiming     bool              `json:"server_timing" yaml:"server_timing" description:"Add the Server-Timing response header."`
+	Heartbeat        string            `json:"heartbeat" yaml:"heartbeat" description:"Interval of heartbeats for long running requests, such as 30s. Empty disables heartbeats."`
+	AbortStatus      int               `json:"abort_status" yaml:"abort_status" description:"Status logged when the client disconnects. Zero logs the handler status."`
+	TLSVerbosity     string            `json:"tls_verbosity" yaml:"tls_verbosity" description:"TLS detail recorded: none, basic, connection, or client_certificate."`
+	QueueTrusted     []string          `json:"queue_trusted" yaml:"queue_trusted" description:"Prefixes of proxies trusted to set the queue start headers. Empty disables queue time."`
+}
+
+// NewConfig returns a Config with the default values of the middleware. The
+// version and environment are left empty so that base providers can set
+// them. The middleware falls back to its own defaults when they are unset.
+func NewConfig() *Config {
+	return &Config{
+		SampleRate:       1,
+		Level:            LevelInfo,
+		ServerErrorLevel: LevelInfo,
+		TLSVerbosity:     "basic",
+	}
+}
+
+// Name of the configuration section.
+func (*Config) Name() string {
+	return "httplog"
+}
+
+// Description of the configuration section.
+func (*Config) Description() string {
+	return "HTTP access logging."
+}
+
+// LoadConfigFromEnv reads the configuration from environment variables named
+// after the fields of the file format, upper cased and joined to the prefix
+// with an underscore, such as HTTPLOG_SERVICE for the prefix HTTPLOG. Lists
+// are comma separated and tags are given as key=value pairs. Variables that
+// are not set keep their default value.
+func LoadConfigFromEnv(prefix string) (*Config, error) {
+	var conf = NewConfig()
+	var lookup = func(name string) (string, bool) {
+		return os.LookupEnv(strings.ToUpper(prefix + "_" + name))
+	}
+	var errs []error
+	var setString = func(name string, field *string) {
+		if value, ok := lookup(name); ok {
+			*field = value
+		}
+	}
+	var setList = func(name string, field *[]string) {
+		if value, ok := lookup(name); ok {
+			*field = splitList(value)
+		}
+	}
+	setString("service", &conf.Service)
+	setString("version", &conf.Version)
+	setString("host", &conf.Host)
+	setString("env", &conf.Env)
+	setList("base_providers", &conf.BaseProviders)
+	setList("redact_parameters", &conf.RedactParameters)
+	setList("request_headers", &conf.RequestHeaders)
+	setList("trailers", &conf.Trailers)
+	setList("debug_routes", &conf.DebugRoutes)
+	setString("level", &conf.Level)
+	setString("server_error_level", &conf.ServerErrorLevel)
+	setString("heartbeat", &conf.Heartbeat)
+	setString("tls_verbosity", &conf.TLSVerbosity)
+	setList("queue_trusted", &conf.QueueTrusted)
+	if value, ok := lookup("tags"); ok {
+		conf.Tags = make(map[string]string)
+		for _, pair := range splitList(value) {
+			var key, tag, found = strings.Cut(pair, "=")
+			if !found {
+				errs = append(errs, fmt.Errorf("tags: %q is not a key=value pair", pair))
+				continue
+			}
+			conf.Tags[strings.TrimSpace(key)] = strings.TrimSpace(tag)
+		}
+	}
+	if value, ok := lookup("sample_rate"); ok {
+		var rate, err = strconv.ParseFloat(value, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sample_rate: %w", err))
+		}
+		conf.SampleRate = rate
+	}
+	if value, ok := lookup("server_timing"); ok {
+		var enabled, err = strconv.ParseBool(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("server_timing: %w", err))
+		}
+		conf.ServerTiming = enabled
+	}
+	if value, ok := lookup("abort_status"); ok {
+		var code, err = strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("abort_status: %w", err))
+		}
+		conf.AbortStatus = code
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return conf, nil
+}
+
+// LoadConfigFromFile reads the configuration from a JSON file, or a YAML file
+// when the name ends in .yaml or .yml. Fields missing from the file keep their
+// default value and unknown fields are an error.
+func LoadConfigFromFile(path string) (*Config, error) {
+	var content, err = os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var conf = NewConfig()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var decoder = yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		err = decoder.Decode(conf)
+	default:
+		var decoder = json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return conf, nil
+}
+
+// Options validates the configuration and returns the equivalent middleware
+// options. All invalid values are reported together.
+func (c *Config) Options() ([]MiddlewareOption, error) {
+	var options []MiddlewareOption
+	var errs []error
+
+	var providers = make([]BaseProvider, 0, len(c.BaseProviders))
+	for _, name := range c.BaseProviders {
+		var provider, ok = baseProviderNames[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("base_providers: unknown provider %q", name))
+			continue
+		}
+		providers = append(providers, provider())
+	}
+	if len(providers) > 0 {
+		options = append(options, MiddlewareOptionBase(providers...))
+	}
+	if c.Service != "" {
+		options = append(options, MiddlewareOptionService(c.Service))
+	}
+	if c.Version != "" {
+		options = append(options, MiddlewareOptionVersion(c.Version))
+	}
+	if c.Host != "" {
+		options = append(options, MiddlewareOptionHost(c.Host))
+	}
+	if c.Env != "" {
+		options = append(options, MiddlewareOptionEnv(c.Env))
+	}
+	for key, value := range c.Tags {
+		if key == "" {
+			errs = append(errs, errors.New("tags: empty tag name"))
+			continue
+		}
+		options = append(options, MiddlewareOptionTag(key, value))
+	}
+	for _, name := range c.RedactParameters {
+		options = append(options, MiddlewareOptionRedactParameter(name))
+	}
+	if len(c.RequestHeaders) > 0 {
+		options = append(options, MiddlewareOptionRequestHeader(c.RequestHeaders...))
+	}
+	if len(c.Trailers) > 0 {
+		options = append(options, MiddlewareOptionTrailer(c.Trailers...))
+	}
+	if len(c.DebugRoutes) > 0 {
+		options = append(options, MiddlewareOptionDebugRoute(c.DebugRoutes...))
+	}
+	if c.SampleRate < 0 || c.SampleRate > 1 {
+		errs = append(errs, fmt.Errorf("sample_rate: %v is not between 0 and 1", c.SampleRate))
+	}
+	options = append(options, MiddlewareOptionSampleRate(c.SampleRate))
+	if !isValidLevel(c.Level) {
+		errs = append(errs, fmt.Errorf("level: unknown level %q", c.Level))
+	}
+	if !isValidLevel(c.ServerErrorLevel) {
+		errs = append(errs, fmt.Errorf("server_error_level: unknown level %q", c.ServerErrorLevel))
+	}
+	options = append(options, MiddlewareOptionLevel(c.Level, c.ServerErrorLevel))
+	if c.ServerTiming {
+		options = append(options, MiddlewareOptionServerTiming())
+	}
+	if c.Heartbeat != "" {
+		var interval, err = time.ParseDuration(c.Heartbeat)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("heartbeat: %w", err))
+		case interval < 0:
+			errs = append(errs, fmt.Errorf("heartbeat: %v is negative", interval))
+		default:
+			options = append(options, MiddlewareOptionHeartbeat(interval))
+		}
+	}
+	if c.AbortStatus != 0 && (c.AbortStatus < 100 || c.AbortStatus > 599) {
+		errs = append(errs, fmt.Errorf("abort_status: %d is not a valid status code", c.AbortStatus))
+	}
+	options = append(options, MiddlewareOptionAbortStatus(c.AbortStatus))
+	var verbosity, ok = tlsVerbosityNames[c.TLSVerbosity]
+	if !ok {
+		errs = append(errs, fmt.Errorf("tls_verbosity: unknown verbosity %q", c.TLSVerbosity))
+	}
+	options = append(options, MiddlewareOptionTLSVerbosity(verbosity))
+	var trusted = make([]netip.Prefix, 0, len(c.QueueTrusted))
+	for _, value := range c.QueueTrusted {
+		var prefix, err = netip.ParsePrefix(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("queue_trusted: %w", err))
+			continue
+		}
+		trusted = append(trusted, prefix)
+	}
+	if len(trusted) > 0 {
+		options = append(options, MiddlewareOptionQueueTime(trusted...))
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return options, nil
+}
+
+// Component builds the middleware from a Config. Settings returns the default
+// configuration to be populated from a settings source and New returns the
+// middleware described by the populated configuration.
+type Component struct{}
+
+// NewComponent creates a Component.
+func NewComponent() *Component {
+	return &Component{}
+}
+
+// Settings returns the default configuration.
+func (*Component) Settings() *Config {
+	return NewConfig()
+}
+
+// New validates the configuration and returns the middleware.
+func (*Component) New(_ context.Context, conf *Config) (func(http.Handler) http.Handler, error) {
+	var options, err = conf.Options()
+	if err != nil {
+		return nil, err
+	}
+	return NewMiddleware(options...), nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,119 @@
+package httplog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("HTTPLOG_SERVICE", "test")
+	t.Setenv("HTTPLOG_TAGS", "region=us-east-1, team = edge")
+	t.Setenv("HTTPLOG_REQUEST_HEADERS", "X-Forwarded-Proto,X-Client")
+	t.Setenv("HTTPLOG_SAMPLE_RATE", "0.25")
+	t.Setenv("HTTPLOG_SERVER_TIMING", "true")
+
+	var conf, err = LoadConfigFromEnv("httplog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Service != "test" || conf.Env != "" || conf.SampleRate != 0.25 || !conf.ServerTiming {
+		t.Fatalf("unexpected configuration %+v", conf)
+	}
+	if conf.Tags["region"] != "us-east-1" || conf.Tags["team"] != "edge" || len(conf.RequestHeaders) != 2 {
+		t.Fatalf("unexpected configuration %+v", conf)
+	}
+	var options []MiddlewareOption
+	if options, err = conf.Options(); err != nil {
+		t.Fatal(err)
+	}
+	var m = newMiddleware("host", nil, options...)
+	if m.service != "test" || m.env != "production" || m.sampleRate != 0.25 || !m.serverTiming || m.tags["team"] != "edge" {
+		t.Fatalf("options were not applied, %+v", m)
+	}
+
+	t.Setenv("HTTPLOG_SAMPLE_RATE", "half")
+	if _, err = LoadConfigFromEnv("httplog"); err == nil || !strings.Contains(err.Error(), "sample_rate") {
+		t.Fatalf("expected a sample_rate error but got %v", err)
+	}
+}
+
+func TestLoadConfigFromFile(t *testing.T) {
+	var dir = t.TempDir()
+	var yamlPath = filepath.Join(dir, "httplog.yaml")
+	var yamlContent = "service: test\nlevel: warn\nheartbeat: 30s\ntls_verbosity: connection\nqueue_trusted:\n  - 10.0.0.0/8\n"
+	if err := os.WriteFile(yamlPath, []byte(yamlContent), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var jsonPath = filepath.Join(dir, "httplog.json")
+	if err := os.WriteFile(jsonPath, []byte(`{"service": "test", "level": "warn", "heartbeat": "30s", "tls_verbosity": "connection", "queue_trusted": ["10.0.0.0/8"]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{yamlPath, jsonPath} {
+		var component = NewComponent()
+		var conf, err = LoadConfigFromFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = component.New(context.Background(), conf); err != nil {
+			t.Fatal(err)
+		}
+		var options, _ = conf.Options()
+		var m = newMiddleware("host", nil, options...)
+		if m.service != "test" || m.level != LevelWarn || m.heartbeat.String() != "30s" || m.tlsVerbosity != TLSVerbosityConnection || len(m.queueTrusted) != 1 {
+			t.Fatalf("options from %s were not applied, %+v", path, m)
+		}
+	}
+
+	var unknownPath = filepath.Join(dir, "unknown.json")
+	if err := os.WriteFile(unknownPath, []byte(`{"servce": "test"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadConfigFromFile(unknownPath); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestConfigBaseProviders(t *testing.T) {
+	t.Setenv("DD_VERSION", "1.2.3")
+	t.Setenv("DD_ENV", "staging")
+	t.Setenv("HTTPLOG_BASE_PROVIDERS", "environment")
+
+	var conf, err = LoadConfigFromEnv("httplog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var options []MiddlewareOption
+	if options, err = conf.Options(); err != nil {
+		t.Fatal(err)
+	}
+	var m = newMiddleware("host", nil, options...)
+	if m.version != "1.2.3" || m.env != "staging" {
+		t.Fatalf("base providers were overridden, version %q and env %q", m.version, m.env)
+	}
+}
+
+func TestConfigOptionsValidation(t *testing.T) {
+	var conf = NewComponent().Settings()
+	conf.SampleRate = 2
+	conf.Level = "loud"
+	conf.Heartbeat = "soon"
+	conf.AbortStatus = 42
+	conf.TLSVerbosity = "all"
+	conf.QueueTrusted = []string{"10.0.0.0"}
+	conf.BaseProviders = []string{"cloud"}
+	var _, err = conf.Options()
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, field := range []string{"sample_rate", "level", "heartbeat", "abort_status", "tls_verbosity", "queue_trusted", "base_providers"} {
+		if !strings.Contains(err.Error(), field+":") {
+			t.Fatalf("expected an error for %s but got %v", field, err)
+		}
+	}
+	if _, err = NewComponent().New(context.Background(), conf); err == nil {
+		t.Fatal("expected the component to reject the configuration")
+	}
+}
@@ -0,0 +1,127 @@
+package httplog
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+var ctxKeyConnection = ctxKey("_httplog_connection")
+
+// connStats accumulates the activity of a single connection.
+type connStats struct {
+	id       string
+	srcIP    string
+	start    time.Time
+	requests int64
+	bytesIn  int64
+	bytesOut int64
+	state    int32
+	once     sync.Once
+}
+
+// nextRequest returns the one based index of a new request on the connection.
+func (c *connStats) nextRequest() int64 {
+	return atomic.AddInt64(&c.requests, 1)
+}
+
+func (c *connStats) add(bytesIn int64, bytesOut int64) {
+	atomic.AddInt64(&c.bytesIn, bytesIn)
+	atomic.AddInt64(&c.bytesOut, bytesOut)
+}
+
+func connStatsFromContext(ctx context.Context) *connStats {
+	var stats, _ = ctx.Value(ctxKeyConnection).(*connStats)
+	return stats
+}
+
+// ConnTracker assigns an identifier to each connection accepted by an
+// http.Server, counts the requests served on it, and emits a Connection event
+// when the server is done with it. Requests served through the middleware on a
+// tracked connection have connection_id and connection_request_index set in
+// their access log. It must be installed on the http.Server:
+//
+//	var tracker = httplog.NewConnTracker(logger, httplog.MiddlewareOptionService("myService"))
+//	var server = &http.Server{
+//		Handler:     httplog.NewMiddleware(httplog.MiddlewareOptionService("myService"))(mux),
+//		ConnContext: tracker.ConnContext,
+//		ConnState:   tracker.ConnState,
+//	}
+type ConnTracker struct {
+	logger logevent.Logger
+	base   Base
+	prefix string
+	count  uint64
+	conns  sync.Map
+}
+
+// NewConnTracker creates a ConnTracker that emits Connection events to the
+// given logger. The options are the same as those given to NewMiddleware and
+// are used to populate the Base fields of the events.
+func NewConnTracker(logger logevent.Logger, options ...MiddlewareOption) *ConnTracker {
+	var prefix = make([]byte, 4)
+	_, _ = rand.Read(prefix)
+	return &ConnTracker{
+		logger: logger,
+		base:   baseFromOptions(options...),
+		prefix: hex.EncodeToString(prefix),
+	}
+}
+
+// ConnContext assigns an identifier to a new connection and installs its
+// statistics into the context of every request served on it. It is suitable
+// for http.Server.ConnContext.
+func (t *ConnTracker) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	var srcIP, _, _ = net.SplitHostPort(conn.RemoteAddr().String())
+	var stats = &connStats{
+		id:    t.prefix + "-" + strconv.FormatUint(atomic.AddUint64(&t.count, 1), 10),
+		srcIP: srcIP,
+		start: time.Now(),
+		state: int32(http.StateNew),
+	}
+	t.conns.Store(conn, stats)
+	return context.WithValue(ctx, ctxKeyConnection, stats)
+}
+
+// ConnState records connection state changes and emits a Connection event
+// once the connection is closed or hijacked. It is suitable for
+// http.Server.ConnState.
+func (t *ConnTracker) ConnState(conn net.Conn, state http.ConnState) {
+	var value, ok = t.conns.Load(conn)
+	if !ok {
+		return
+	}
+	var stats = value.(*connStats)
+	switch state {
+	case http.StateClosed, http.StateHijacked:
+		t.conns.Delete(conn)
+		var finalState = http.ConnState(atomic.LoadInt32(&stats.state))
+		if state == http.StateHijacked {
+			finalState = state
+		}
+		stats.once.Do(func() { t.emit(stats, finalState) })
+	default:
+		atomic.StoreInt32(&stats.state, int32(state))
+	}
+}
+
+func (t *ConnTracker) emit(stats *connStats, finalState http.ConnState) {
+	t.logger.Info(Connection{
+		Base:         t.base,
+		ConnectionID: stats.id,
+		SourceIP:     stats.srcIP,
+		Requests:     atomic.LoadInt64(&stats.requests),
+		BytesIn:      atomic.LoadInt64(&stats.bytesIn),
+		BytesOut:     atomic.LoadInt64(&stats.bytesOut),
+		Duration:     int(time.Since(stats.start).Nanoseconds() / 1e6),
+		FinalState:   finalState.String(),
+	})
+}
@@ -0,0 +1,91 @@
+package httplog
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestConnTrackerKeepAlive(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var accessLogger = NewMockLogger(ctrl)
+	var tracker = NewConnTracker(logger, MiddlewareOptionService("test"))
+	var accesses []map[string]interface{}
+	var fields = map[string]interface{}{}
+	var done = make(chan Connection, 1)
+	logger.EXPECT().Copy().Return(accessLogger).Times(2)
+	accessLogger.EXPECT().SetField(gomock.Any(), gomock.Any()).Do(func(name string, value interface{}) {
+		fields[name] = value
+	}).Times(4)
+	accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		accesses = append(accesses, fields)
+		fields = map[string]interface{}{}
+	}).Times(2)
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		done <- event.(Connection)
+	})
+
+	var m = NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		_, _ = w.Write([]byte("echo"))
+	}))
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeHTTP(w, r.WithContext(logevent.NewContext(r.Context(), logger)))
+	}))
+	server.Config.ConnContext = tracker.ConnContext
+	server.Config.ConnState = tracker.ConnState
+	server.Start()
+	defer server.Close()
+
+	var client = server.Client()
+	for x := 0; x < 2; x = x + 1 {
+		var resp, err = client.Post(server.URL, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	client.CloseIdleConnections()
+
+	var conn = <-done
+	if len(accesses) != 2 {
+		t.Fatalf("expected 2 access logs but got %d", len(accesses))
+	}
+	for x, access := range accesses {
+		if access["connection_id"] != conn.ConnectionID {
+			t.Fatalf("access log %d has connection %v but expected %q", x, access["connection_id"], conn.ConnectionID)
+		}
+		if access["connection_request_index"] != int64(x+1) {
+			t.Fatalf("access log %d has request index %v", x, access["connection_request_index"])
+		}
+	}
+	if conn.Requests != 2 || conn.BytesIn != 10 || conn.BytesOut != 8 {
+		t.Fatalf("unexpected connection event, %v", conn)
+	}
+	if conn.Service != "test" || conn.FinalState != http.StateIdle.String() {
+		t.Fatalf("unexpected connection event, %v", conn)
+	}
+}
+
+func TestConnTrackerUntracked(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any())
+	var r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	r = r.WithContext(logevent.NewContext(r.Context(), logger))
+	NewMiddleware()(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), r)
+}
@@ -0,0 +1,72 @@
+package httplog
+
+import (
+	"net/http"
+)
+
+// AccessRecord returns the Access value itself. Because the method is
+// promoted through embedding, it allows any struct that embeds Access to be
+// used as a custom access log schema with NewMiddlewareFor.
+func (a *Access) AccessRecord() *Access {
+	return a
+}
+
+// EventRecord returns the Event value itself. Because the method is promoted
+// through embedding, it allows the middleware to recognize any struct that
+// embeds Event as a service event.
+func (e Event) EventRecord() Event {
+	return e
+}
+
+// eventEmbedder is satisfied by Event and any struct that embeds it.
+type eventEmbedder interface {
+	EventRecord() Event
+}
+
+// AccessEmbedder is satisfied by a pointer to any struct that embeds Access.
+type AccessEmbedder[T any] interface {
+	*T
+	AccessRecord() *Access
+}
+
+// AccessExtractor populates the custom fields of an access log schema once
+// the handler has returned. It is given the request along with the final
+// response status and headers. The embedded Access value is already complete
+// when the extractor is called.
+type AccessExtractor[T any] func(record *T, r *http.Request, status int, header http.Header)
+
+// NewMiddlewareFor generates an HTTP handler wrapper identical to the one
+// returned by NewMiddleware except that access logs are emitted using a custom
+// schema. The schema type must be a struct that embeds Access and any extra
+// fields must carry logevent tags like the built in schemas:
+//
+//	type MyAccess struct {
+//		httplog.Access
+//		Region string `logevent:"region"`
+//	}
+//
+//	var middleware = httplog.NewMiddlewareFor[MyAccess](
+//		func(a *MyAccess, r *http.Request, status int, header http.Header) {
+//			a.Region = r.Header.Get("X-Region")
+//		},
+//	)
+func NewMiddlewareFor[T any, PT AccessEmbedder[T]](extractor AccessExtractor[T], options ...MiddlewareOption) func(http.Handler) http.Handler {
+	var record = func(r *http.Request, status int, header http.Header, access Access) interface{} {
+		var custom T
+		*PT(&custom).AccessRecord() = access
+		if extractor != nil {
+			extractor(&custom, r, status, header)
+		}
+		return custom
+	}
+	return NewMiddleware(append([]MiddlewareOption{middlewareOptionRecord(record)}, options...)...)
+}
+
+// middlewareOptionRecord sets the function used to convert a completed Access
+// value into the event that is logged.
+func middlewareOptionRecord(record func(*http.Request, int, http.Header, Access) interface{}) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.record = record
+		return m
+	}
+}
@@ -0,0 +1,58 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+type fixtureCustomAccess struct {
+	Access
+	Region string `logevent:"region"`
+	Canary string `logevent:"canary"`
+}
+
+func TestNewMiddlewareFor(t *testing.T) {
+	var output = &bytes.Buffer{}
+	var logger = logevent.New(logevent.Config{Output: output})
+	var result = NewMiddlewareFor[fixtureCustomAccess](
+		func(a *fixtureCustomAccess, r *http.Request, status int, header http.Header) {
+			if a.Access.Status != http.StatusTeapot {
+				t.Errorf("extractor called before Access was completed, %v", a.Access)
+			}
+			a.Region = r.Header.Get("X-Region")
+			a.Canary = header.Get("X-Canary")
+		},
+		MiddlewareOptionService("service"),
+	)
+	var m = result(fixtureHandlerStatus{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req.Header.Set("X-Region", "us-west-2")
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+	m.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(output.Bytes(), &line); err != nil {
+		t.Fatalf("access log was not valid JSON: %s", err)
+	}
+	for key, expected := range map[string]interface{}{
+		"region":  "us-west-2",
+		"canary":  "build-2",
+		"status":  float64(http.StatusTeapot),
+		"service": "service",
+		"schema":  "access",
+		"message": "access",
+	} {
+		if line[key] != expected {
+			t.Fatalf("expected %s to be %v but got %v in %s", key, expected, line[key], output.String())
+		}
+	}
+}
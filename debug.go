@@ -0,0 +1,37 @@
+package httplog
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MiddlewareOptionDebugRoute enables debug detail for requests whose route,
+// as set with SetRoute, or path matches one of the given values. Their access
+// logs are never sampled out, are marked with the debug field, and record all
+// request headers with the values of credentials masked.
+func MiddlewareOptionDebugRoute(routes ...string) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.debugRoutes = append(m.debugRoutes, routes...)
+		return m
+	}
+}
+
+// isDebugRoute reports whether debug detail is enabled for the request.
+func (m *Middleware) isDebugRoute(a *Access) bool {
+	for _, route := range m.debugRoutes {
+		if (a.Route != "" && a.Route == route) || a.URIPath == route {
+			return true
+		}
+	}
+	return false
+}
+
+// debugHeaders returns every request header with the values of those that
+// may carry credentials masked.
+func debugHeaders(header http.Header) map[string]string {
+	var captured = make(map[string]string, len(header))
+	for name, values := range header {
+		captured[name] = maskSecret(name, strings.Join(values, ", "))
+	}
+	return captured
+}
@@ -0,0 +1,83 @@
+package httplog
+
+import (
+	"log"
+	"net"
+	"regexp"
+	"strings"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// Classes assigned to the messages written by net/http to the server
+// ErrorLog.
+const (
+	ServerErrorTLSHandshake   = "tls_handshake"
+	ServerErrorPanic          = "panic"
+	ServerErrorAccept         = "accept"
+	ServerErrorHeaderTooLarge = "header_too_large"
+	ServerErrorWriteHeader    = "superfluous_write_header"
+	ServerErrorHijacked       = "hijacked"
+	ServerErrorHTTP2          = "http2"
+	ServerErrorUnknown        = "unknown"
+)
+
+type serverErrorPattern struct {
+	class   string
+	pattern *regexp.Regexp
+}
+
+// serverErrorPatterns are checked in order and the first match wins. The
+// pattern may capture the address of the peer in a group named addr.
+var serverErrorPatterns = []serverErrorPattern{
+	{ServerErrorTLSHandshake, regexp.MustCompile(`TLS handshake error from (?P<addr>\S+?):? `)},
+	{ServerErrorPanic, regexp.MustCompile(`panic serving (?P<addr>\S+?):? `)},
+	{ServerErrorAccept, regexp.MustCompile(`Accept error: `)},
+	{ServerErrorHeaderTooLarge, regexp.MustCompile(`(?i)header.*too large|too large.*header`)},
+	{ServerErrorWriteHeader, regexp.MustCompile(`superfluous response\.WriteHeader|multiple response\.WriteHeader`)},
+	{ServerErrorHijacked, regexp.MustCompile(`on hijacked connection`)},
+	{ServerErrorHTTP2, regexp.MustCompile(`^http2: `)},
+}
+
+// serverErrorWriter converts each message written by a log.Logger into a
+// ServerError event.
+type serverErrorWriter struct {
+	logger logevent.Logger
+	base   Base
+}
+
+func (w *serverErrorWriter) Write(p []byte) (int, error) {
+	var message = strings.TrimRight(string(p), "\n")
+	var stack string
+	if idx := strings.IndexByte(message, '\n'); idx >= 0 {
+		message, stack = message[:idx], message[idx+1:]
+	}
+	var event = ServerError{
+		Base:       w.base,
+		ErrorClass: ServerErrorUnknown,
+		Error:      message,
+		Stack:      stack,
+	}
+	for _, candidate := range serverErrorPatterns {
+		var match = candidate.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		event.ErrorClass = candidate.class
+		if idx := candidate.pattern.SubexpIndex("addr"); idx > 0 {
+			event.SourceIP, _, _ = net.SplitHostPort(match[idx])
+		}
+		break
+	}
+	w.logger.Error(event)
+	return len(p), nil
+}
+
+// NewServerErrorLog returns a log.Logger suitable for http.Server.ErrorLog.
+// Each message written by net/http, such as TLS handshake failures or panics
+// in a handler, is emitted to the given logger as a ServerError event. The
+// options are the same as those given to NewMiddleware and are used to
+// populate the Base fields of the events.
+func NewServerErrorLog(logger logevent.Logger, options ...MiddlewareOption) *log.Logger {
+	return log.New(&serverErrorWriter{logger: logger, base: baseFromOptions(options...)}, "", 0)
+}
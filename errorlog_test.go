@@ -0,0 +1,76 @@
+package httplog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestServerErrorLogClassification(t *testing.T) {
+	var tests = []struct {
+		name    string
+		message string
+		class   string
+		srcIP   string
+	}{
+		{"tls", "http: TLS handshake error from 10.0.0.1:51234: EOF", ServerErrorTLSHandshake, "10.0.0.1"},
+		{"tlsv6", "http: TLS handshake error from [::1]:51234: remote error: tls: bad certificate", ServerErrorTLSHandshake, "::1"},
+		{"accept", "http: Accept error: accept tcp [::]:80: too many open files; retrying in 5ms", ServerErrorAccept, ""},
+		{"header", "http2: server: error reading request headers: header list too large", ServerErrorHeaderTooLarge, ""},
+		{"writeheader", "http: superfluous response.WriteHeader call from main.handler (main.go:12)", ServerErrorWriteHeader, ""},
+		{"http2", "http2: server: error reading preface from client 10.0.0.2:4000: EOF", ServerErrorHTTP2, ""},
+		{"unknown", "something else", ServerErrorUnknown, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var logger = NewMockLogger(ctrl)
+			logger.EXPECT().Error(gomock.Any()).Do(func(event interface{}) {
+				var evt, ok = event.(ServerError)
+				if !ok {
+					t.Fatalf("expected a ServerError event but got %T", event)
+				}
+				if evt.ErrorClass != tt.class || evt.SourceIP != tt.srcIP || evt.Error != tt.message {
+					t.Fatalf("unexpected event, %v", evt)
+				}
+				if evt.Service != "test" {
+					t.Fatalf("base fields were not populated, %v", evt)
+				}
+			})
+			NewServerErrorLog(logger, MiddlewareOptionService("test")).Print(tt.message)
+		})
+	}
+}
+
+func TestServerErrorLogPanic(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var done = make(chan ServerError, 1)
+	logger.EXPECT().Error(gomock.Any()).Do(func(event interface{}) {
+		done <- event.(ServerError)
+	})
+	var server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+	server.Config.ErrorLog = NewServerErrorLog(logger)
+	server.Start()
+	defer server.Close()
+
+	if resp, err := server.Client().Get(server.URL); err == nil {
+		_ = resp.Body.Close()
+	}
+	var evt = <-done
+	if evt.ErrorClass != ServerErrorPanic || evt.SourceIP != "127.0.0.1" {
+		t.Fatalf("unexpected event, %v", evt)
+	}
+	if !strings.Contains(evt.Error, "boom") || !strings.Contains(evt.Stack, "goroutine") {
+		t.Fatalf("panic message or stack missing, %v", evt)
+	}
+}
@@ -0,0 +1,86 @@
+package httplog
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errorClass pairs a classification name with the function that decides
+// whether an error belongs to it.
+type errorClass struct {
+	name  string
+	match func(error) bool
+}
+
+// ErrorIs returns an error matcher that reports whether errors.Is(err, target).
+func ErrorIs(target error) func(error) bool {
+	return func(err error) bool {
+		return errors.Is(err, target)
+	}
+}
+
+// ErrorAs returns an error matcher that reports whether any error in the
+// chain can be assigned to the type E using errors.As.
+func ErrorAs[E error]() func(error) bool {
+	return func(err error) bool {
+		var target E
+		return errors.As(err, &target)
+	}
+}
+
+// MiddlewareOptionErrorClass registers a classification for errors recorded
+// with SetError. The error_class field of the access log is set to the name
+// of the first registered class whose matcher accepts the error. Common
+// classes are things like "timeout", "validation", "upstream", and "auth".
+func MiddlewareOptionErrorClass(name string, match func(error) bool) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.errorClasses = append(m.errorClasses, errorClass{name: name, match: match})
+		return m
+	}
+}
+
+func classifyError(classes []errorClass, err error) string {
+	for _, class := range classes {
+		if class.match(err) {
+			return class.name
+		}
+	}
+	return ""
+}
+
+// errorType reports the type of the first error in a chain of wrapped errors
+// that is not a generic wrapper from fmt.Errorf or a sentinel from
+// errors.New, so that a wrapped *fs.PathError is reported as such rather than
+// as the sentinel it wraps. Errors that wrap multiple errors, such as those
+// created by fmt.Errorf with several %w verbs, are searched in order. Chains
+// made only of generic errors report the type of the innermost one.
+func errorType(err error) string {
+	var name = fmt.Sprintf("%T", err)
+	if !genericErrorTypes[name] {
+		return name
+	}
+	switch wrapped := err.(type) {
+	case interface{ Unwrap() error }:
+		if next := wrapped.Unwrap(); next != nil {
+			return errorType(next)
+		}
+	case interface{ Unwrap() []error }:
+		var errs = wrapped.Unwrap()
+		for _, next := range errs {
+			if inner := errorType(next); !genericErrorTypes[inner] {
+				return inner
+			}
+		}
+		if len(errs) > 0 {
+			return errorType(errs[0])
+		}
+	}
+	return name
+}
+
+// genericErrorTypes carry no information about the cause of an error.
+var genericErrorTypes = map[string]bool{
+	"*fmt.wrapError":      true,
+	"*fmt.wrapErrors":     true,
+	"*errors.errorString": true,
+}
@@ -0,0 +1,97 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+var errFixtureValidation = errors.New("invalid input")
+
+func TestErrorClassification(t *testing.T) {
+	var classes = []errorClass{
+		{name: "validation", match: ErrorIs(errFixtureValidation)},
+		{name: "filesystem", match: ErrorAs[*os.PathError]()},
+	}
+	var tc = []struct {
+		name          string
+		err           error
+		expectedClass string
+		expectedType  string
+	}{
+		{"is", fmt.Errorf("wrapped: %w", errFixtureValidation), "validation", "*errors.errorString"},
+		{"as", fmt.Errorf("wrapped: %w", &os.PathError{Op: "open", Path: "/", Err: os.ErrNotExist}), "filesystem", "*fs.PathError"},
+		{"none", context.DeadlineExceeded, "", "context.deadlineExceededError"},
+		{"joined", errors.Join(errFixtureValidation), "validation", "*errors.joinError"},
+		{"multiple", fmt.Errorf("%w: %w", errFixtureValidation, &os.PathError{Op: "open", Path: "/", Err: os.ErrNotExist}), "validation", "*fs.PathError"},
+		{"multiple generic", fmt.Errorf("%w: %w", errFixtureValidation, errors.New("other")), "validation", "*errors.errorString"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := classifyError(classes, c.err); actual != c.expectedClass {
+				t.Fatalf("expected class %q but got %q", c.expectedClass, actual)
+			}
+			if actual := errorType(c.err); actual != c.expectedType {
+				t.Fatalf("expected type %q but got %q", c.expectedType, actual)
+			}
+		})
+	}
+}
+
+type fixtureHandlerError struct {
+	err error
+}
+
+func (h fixtureHandlerError) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.err != nil {
+		SetError(r.Context(), h.err)
+	}
+	http.Error(w, "something broke", http.StatusBadGateway)
+}
+
+func TestMiddlewareErrorAttribution(t *testing.T) {
+	var tc = []struct {
+		name          string
+		err           error
+		expectedError string
+		expectedType  string
+		expectedClass string
+	}{
+		{"set error", fmt.Errorf("calling upstream: %w", errFixtureValidation), "calling upstream: invalid input", "*errors.errorString", "validation"},
+		{"http error", nil, "something broke", "", ""},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var logger = NewMockLogger(ctrl)
+			var result = NewMiddleware(MiddlewareOptionErrorClass("validation", ErrorIs(errFixtureValidation)))
+			var m = result(fixtureHandlerError{err: c.err}).(*Middleware)
+			var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+			req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+			logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+				var evt = event.(Access)
+				if evt.Error != c.expectedError || evt.ErrorType != c.expectedType || evt.ErrorClass != c.expectedClass {
+					t.Fatalf("unexpected error attribution, %v", evt)
+				}
+				if evt.Status != http.StatusBadGateway {
+					t.Fatalf("unexpected status, %v", evt)
+				}
+			})
+			m.ServeHTTP(httptest.NewRecorder(), req)
+		})
+	}
+}
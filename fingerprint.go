@@ -0,0 +1,194 @@
+package httplog
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// TLSFingerprint computes a JA4 style fingerprint of a TLS ClientHello. The
+// fingerprint is stable for a given client implementation and configuration
+// regardless of the address or user agent it presents, which makes it useful
+// for clustering scripted clients.
+//
+// The format is "t<version><sni><ciphers><alpn>_<cipher hash>_<group hash>"
+// where version is the highest offered TLS version, sni is "d" when a server
+// name was sent and "i" otherwise, ciphers is the two digit count of offered
+// cipher suites, alpn is the first and last character of the first offered
+// protocol, cipher hash is a truncated SHA-256 of the sorted cipher suites, and
+// group hash is a truncated SHA-256 of the sorted curves, point formats, and
+// signature schemes. It is not byte compatible with JA3 or JA4 because the
+// standard library does not expose the raw list of extensions. GREASE values
+// are ignored.
+func TLSFingerprint(hello *tls.ClientHelloInfo) string {
+	var version = uint16(0)
+	for _, v := range hello.SupportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	var sni = "i"
+	if hello.ServerName != "" {
+		sni = "d"
+	}
+	var ciphers = withoutGREASE(hello.CipherSuites)
+	var curves = make([]uint16, 0, len(hello.SupportedCurves))
+	for _, curve := range hello.SupportedCurves {
+		curves = append(curves, uint16(curve))
+	}
+	var points = make([]uint16, 0, len(hello.SupportedPoints))
+	for _, point := range hello.SupportedPoints {
+		points = append(points, uint16(point))
+	}
+	var schemes = make([]uint16, 0, len(hello.SignatureSchemes))
+	for _, scheme := range hello.SignatureSchemes {
+		schemes = append(schemes, uint16(scheme))
+	}
+	return fmt.Sprintf(
+		"t%s%s%02d%s_%s_%s",
+		fingerprintVersion(version),
+		sni,
+		min(len(ciphers), 99),
+		fingerprintALPN(hello.SupportedProtos),
+		fingerprintHash(sortedHex(ciphers)),
+		fingerprintHash(sortedHex(withoutGREASE(curves))+"_"+sortedHex(points)+"_"+sortedHex(schemes)),
+	)
+}
+
+// isGREASE reports whether a value is one of the reserved values that clients
+// send to keep servers tolerant of unknown values.
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func withoutGREASE(values []uint16) []uint16 {
+	var result = make([]uint16, 0, len(values))
+	for _, v := range values {
+		if !isGREASE(v) {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func fingerprintVersion(version uint16) string {
+	switch version {
+	case tls.VersionTLS13:
+		return "13"
+	case tls.VersionTLS12:
+		return "12"
+	case tls.VersionTLS11:
+		return "11"
+	case tls.VersionTLS10:
+		return "10"
+	default:
+		return "00"
+	}
+}
+
+func fingerprintALPN(protos []string) string {
+	if len(protos) == 0 || protos[0] == "" {
+		return "00"
+	}
+	var proto = protos[0]
+	return string(proto[0]) + string(proto[len(proto)-1])
+}
+
+func sortedHex(values []uint16) string {
+	var sorted = append([]uint16(nil), values...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var parts = make([]string, 0, len(sorted))
+	for _, v := range sorted {
+		parts = append(parts, fmt.Sprintf("%04x", v))
+	}
+	return strings.Join(parts, ",")
+}
+
+func fingerprintHash(value string) string {
+	if value == "" {
+		return strings.Repeat("0", 12)
+	}
+	var sum = sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Fingerprinter records the TLS ClientHello fingerprint of each connection so
+// that the middleware can add it to the access log of every request served on
+// that connection. The fingerprint is held in the context of the connection,
+// so it must be installed on both the tls.Config and the http.Server:
+//
+//	var fingerprinter = httplog.NewFingerprinter()
+//	var server = &http.Server{
+//		Handler:     httplog.NewMiddleware(httplog.MiddlewareOptionFingerprinter(fingerprinter))(mux),
+//		ConnContext: fingerprinter.ConnContext,
+//		TLSConfig: &tls.Config{
+//			GetConfigForClient: fingerprinter.GetConfigForClient(nil),
+//		},
+//	}
+//
+// Servers that also track connections chain the two ConnContext functions.
+type Fingerprinter struct{}
+
+// NewFingerprinter creates a Fingerprinter.
+func NewFingerprinter() *Fingerprinter {
+	return &Fingerprinter{}
+}
+
+// connFingerprint holds the fingerprint of a connection once its handshake
+// has completed.
+type connFingerprint struct {
+	value atomic.Pointer[string]
+}
+
+var ctxKeyFingerprint = ctxKey("_httplog_fingerprint")
+
+// ConnContext installs a holder for the fingerprint of a new connection into
+// its context. It is suitable for http.Server.ConnContext.
+func (f *Fingerprinter) ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, ctxKeyFingerprint, &connFingerprint{})
+}
+
+// GetConfigForClient returns a function suitable for
+// tls.Config.GetConfigForClient that records the fingerprint of the
+// connection before calling next. A nil next keeps the original tls.Config.
+// Connections without a holder installed by ConnContext are not recorded.
+func (f *Fingerprinter) GetConfigForClient(next func(*tls.ClientHelloInfo) (*tls.Config, error)) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		if holder, ok := hello.Context().Value(ctxKeyFingerprint).(*connFingerprint); ok {
+			var fingerprint = TLSFingerprint(hello)
+			holder.value.Store(&fingerprint)
+		}
+		if next == nil {
+			return nil, nil
+		}
+		return next(hello)
+	}
+}
+
+// fingerprintFromContext returns the fingerprint recorded for the connection
+// of a request, or an empty string if there is none.
+func fingerprintFromContext(ctx context.Context) string {
+	var holder, ok = ctx.Value(ctxKeyFingerprint).(*connFingerprint)
+	if !ok {
+		return ""
+	}
+	if fingerprint := holder.value.Load(); fingerprint != nil {
+		return *fingerprint
+	}
+	return ""
+}
+
+// MiddlewareOptionFingerprinter adds the TLS ClientHello fingerprint recorded
+// by the Fingerprinter to the tls_fingerprint field of the access log.
+func MiddlewareOptionFingerprinter(f *Fingerprinter) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.fingerprinter = f
+		return m
+	}
+}
@@ -0,0 +1,97 @@
+package httplog
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestTLSFingerprint(t *testing.T) {
+	var hello = &tls.ClientHelloInfo{
+		CipherSuites:      []uint16{0x1a1a, tls.TLS_AES_256_GCM_SHA384, tls.TLS_AES_128_GCM_SHA256},
+		ServerName:        "example.com",
+		SupportedCurves:   []tls.CurveID{0x2a2a, tls.X25519, tls.CurveP256},
+		SupportedPoints:   []uint8{0},
+		SignatureSchemes:  []tls.SignatureScheme{tls.ECDSAWithP256AndSHA256, tls.PSSWithSHA256},
+		SupportedProtos:   []string{"h2", "http/1.1"},
+		SupportedVersions: []uint16{0x3a3a, tls.VersionTLS13, tls.VersionTLS12},
+	}
+	var fingerprint = TLSFingerprint(hello)
+	if !regexp.MustCompile(`^t13d02h2_[0-9a-f]{12}_[0-9a-f]{12}$`).MatchString(fingerprint) {
+		t.Fatalf("unexpected fingerprint format %q", fingerprint)
+	}
+
+	var reordered = *hello
+	reordered.CipherSuites = []uint16{tls.TLS_AES_128_GCM_SHA256, 0x2a2a, tls.TLS_AES_256_GCM_SHA384}
+	reordered.SupportedCurves = []tls.CurveID{tls.CurveP256, tls.X25519}
+	if actual := TLSFingerprint(&reordered); actual != fingerprint {
+		t.Fatalf("fingerprint changed with ordering or GREASE values: %q != %q", actual, fingerprint)
+	}
+
+	var different = *hello
+	different.ServerName = ""
+	different.SupportedProtos = nil
+	different.CipherSuites = []uint16{tls.TLS_AES_128_GCM_SHA256}
+	var actual = TLSFingerprint(&different)
+	if !regexp.MustCompile(`^t13i0100_`).MatchString(actual) || strings.Split(actual, "_")[1] == strings.Split(fingerprint, "_")[1] {
+		t.Fatalf("fingerprint did not reflect a different client %q", actual)
+	}
+}
+
+func TestMiddlewareOptionFingerprinter(t *testing.T) {
+	var tc = []struct {
+		name        string
+		connContext bool
+	}{
+		{"recorded", true},
+		{"without conn context", false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var logger = NewMockLogger(ctrl)
+			var accessLogger = NewMockLogger(ctrl)
+			var fingerprints = make(chan string, 1)
+			if c.connContext {
+				logger.EXPECT().Copy().Return(accessLogger)
+				accessLogger.EXPECT().SetField("tls_fingerprint", gomock.Any()).Do(func(name string, value interface{}) {
+					fingerprints <- value.(string)
+				})
+				accessLogger.EXPECT().Info(gomock.Any())
+			} else {
+				logger.EXPECT().Info(gomock.Any())
+			}
+			var fingerprinter = NewFingerprinter()
+			var m = NewMiddleware(MiddlewareOptionFingerprinter(fingerprinter), MiddlewareOptionTLSVerbosity(TLSVerbosityNone))(fixtureHandler{})
+			var server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				m.ServeHTTP(w, r.WithContext(logevent.NewContext(r.Context(), logger)))
+			}))
+			server.TLS = &tls.Config{GetConfigForClient: fingerprinter.GetConfigForClient(nil)} // nolint:gosec
+			if c.connContext {
+				server.Config.ConnContext = fingerprinter.ConnContext
+			}
+			server.StartTLS()
+			defer server.Close()
+
+			var resp, err = server.Client().Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_ = resp.Body.Close()
+			if !c.connContext {
+				return
+			}
+			if fingerprint := <-fingerprints; !regexp.MustCompile(`^t1[23]i`).MatchString(fingerprint) {
+				t.Fatalf("access log did not contain the connection fingerprint %q", fingerprint)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ toolchain go1.23.1
 require (
 	github.com/asecurityteam/logevent/v2 v2.0.1
 	github.com/golang/mock v1.6.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -0,0 +1,33 @@
+package httplog
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MiddlewareOptionRequestHeader records the value of the named request
+// headers in the request_headers field of the access log. The values of
+// headers whose name suggests a credential, such as Authorization or Cookie,
+// are masked.
+func MiddlewareOptionRequestHeader(names ...string) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.headers = append(m.headers, names...)
+		return m
+	}
+}
+
+// captureHeaders returns the values of the named headers present in the
+// request. Repeated headers are joined with a comma and credentials are
+// masked.
+func captureHeaders(names []string, header http.Header) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	var captured = make(map[string]string, len(names))
+	for _, name := range names {
+		if values := header.Values(name); len(values) > 0 {
+			captured[http.CanonicalHeaderKey(name)] = maskSecret(name, strings.Join(values, ", "))
+		}
+	}
+	return captured
+}
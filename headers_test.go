@@ -0,0 +1,28 @@
+package httplog
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestMiddlewareOptionRequestHeader(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		if len(evt.RequestHeaders) != 2 || evt.RequestHeaders["X-Forwarded-Proto"] != "https, http" {
+			t.Fatalf("unexpected request headers %v", evt.RequestHeaders)
+		}
+		if evt.RequestHeaders["Authorization"] != "REDACTED" {
+			t.Fatalf("credentials were not masked, %v", evt.RequestHeaders)
+		}
+	})
+	var m = NewMiddleware(MiddlewareOptionRequestHeader("x-forwarded-proto", "X-Missing", "Authorization"))
+	var req = newLevelRequest(logger)
+	req.Header.Set("Authorization", "Bearer secret")
+	m(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), req)
+}
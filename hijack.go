@@ -0,0 +1,88 @@
+package httplog
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// hijackedConn counts the traffic on a connection that was taken over from
+// the HTTP server and reports it once the connection is closed.
+type hijackedConn struct {
+	net.Conn
+	bytesIn  int64
+	bytesOut int64
+	start    time.Time
+	once     sync.Once
+	onClose  func(*hijackedConn)
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	var n, err = c.Conn.Read(p)
+	atomic.AddInt64(&c.bytesIn, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Write(p []byte) (int, error) {
+	var n, err = c.Conn.Write(p)
+	atomic.AddInt64(&c.bytesOut, int64(n))
+	return n, err
+}
+
+func (c *hijackedConn) Close() error {
+	var err = c.Conn.Close()
+	c.once.Do(func() { c.onClose(c) })
+	return err
+}
+
+// wrapHijacked replaces a hijacked connection with one that counts traffic.
+// The returned buffers read any data the server had already buffered before
+// continuing with the counted connection.
+func wrapHijacked(conn net.Conn, brw *bufio.ReadWriter, onClose func(*hijackedConn)) (net.Conn, *bufio.ReadWriter) {
+	if conn == nil {
+		return conn, brw
+	}
+	var counted = &hijackedConn{Conn: conn, start: time.Now(), onClose: onClose}
+	var reader io.Reader = counted
+	if brw != nil && brw.Reader.Buffered() > 0 {
+		var buffered, _ = brw.Reader.Peek(brw.Reader.Buffered())
+		counted.bytesIn = int64(len(buffered))
+		reader = io.MultiReader(bytes.NewReader(bytes.Clone(buffered)), counted)
+	}
+	return counted, bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(counted))
+}
+
+// trackHijack installs the hook that emits a Session event when a hijacked
+// connection is closed.
+func trackHijack(wrapper writerProxy, r *http.Request, base Base) {
+	var srcIP, _, _ = net.SplitHostPort(r.RemoteAddr)
+	var upgrade = upgradeProtocol(r)
+	wrapper.OnHijack(func(conn net.Conn, brw *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter) {
+		return wrapHijacked(conn, brw, func(c *hijackedConn) {
+			logevent.FromContext(r.Context()).Info(Session{
+				Base:     base,
+				Upgraded: upgrade,
+				SourceIP: srcIP,
+				URIPath:  r.URL.Path,
+				BytesIn:  atomic.LoadInt64(&c.bytesIn),
+				BytesOut: atomic.LoadInt64(&c.bytesOut),
+				Duration: int(time.Since(c.start).Nanoseconds() / 1e6),
+			})
+		})
+	})
+}
+
+// upgradeProtocol returns the lower case protocol named in the Upgrade
+// header, such as "websocket", or an empty string.
+func upgradeProtocol(r *http.Request) string {
+	var protocol, _, _ = strings.Cut(r.Header.Get("Upgrade"), ",")
+	return strings.ToLower(strings.TrimSpace(protocol))
+}
@@ -0,0 +1,128 @@
+package httplog
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureHandlerUpgrade struct{}
+
+func (fixtureHandlerUpgrade) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var conn, brw, err = w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	_, _ = brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	_ = brw.Flush()
+	var ping = make([]byte, 4)
+	if _, err = io.ReadFull(brw, ping); err != nil {
+		return
+	}
+	_, _ = brw.WriteString("pong")
+	_ = brw.Flush()
+}
+
+func TestMiddlewareHijackedConnection(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var accessLogger, fields = expectAccessFields(ctrl, logger)
+	var done = make(chan struct{})
+	gomock.InOrder(
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			var evt, ok = event.(Session)
+			if !ok {
+				t.Errorf("expected a Session event but got %T", event)
+				return
+			}
+			if evt.Upgraded != "websocket" || evt.BytesIn != 4 || evt.BytesOut != 81 {
+				t.Errorf("unexpected session event, %v", evt)
+			}
+		}),
+		accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			defer close(done)
+			if evt := event.(Access); evt.Status != http.StatusSwitchingProtocols {
+				t.Errorf("access log did not record the upgrade status, %v", evt)
+			}
+		}),
+	)
+	var m = NewMiddleware()(fixtureHandlerUpgrade{})
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeHTTP(w, r.WithContext(logevent.NewContext(r.Context(), logger)))
+	}))
+	defer server.Close()
+
+	var conn, err = net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n"))
+	var reader = bufio.NewReader(conn)
+	var resp *http.Response
+	if resp, err = http.ReadResponse(reader, nil); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("unexpected status %d", resp.StatusCode)
+	}
+	_, _ = conn.Write([]byte("ping"))
+	var pong = make([]byte, 4)
+	if _, err = io.ReadFull(reader, pong); err != nil || string(pong) != "pong" {
+		t.Fatalf("unexpected response %q, %v", pong, err)
+	}
+	<-done
+	if fields["hijacked"] != true || fields["upgraded"] != "websocket" {
+		t.Fatalf("access log did not record the upgrade, %v", fields)
+	}
+}
+
+func TestMiddlewareHijackedWithoutUpgrade(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var accessLogger, fields = expectAccessFields(ctrl, logger)
+	var done = make(chan struct{})
+	accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt, ok = event.(Access)
+		if !ok {
+			return
+		}
+		defer close(done)
+		if evt.Status != 0 {
+			t.Errorf("unexpected status for a hijacked connection, %v", evt)
+		}
+	}).Times(2)
+	var m = NewMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var conn, _, err = w.(http.Hijacker).Hijack()
+		if err == nil {
+			_ = conn.Close()
+		}
+	}))
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeHTTP(w, r.WithContext(logevent.NewContext(r.Context(), logger)))
+	}))
+	defer server.Close()
+
+	var conn, err = net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("GET / HTTP/1.1\r\nHost: example\r\n\r\n"))
+	_, _ = io.ReadAll(conn)
+	<-done
+	if fields["hijacked"] != true || fields["upgraded"] != nil {
+		t.Fatalf("unexpected hijack fields, %v", fields)
+	}
+}
@@ -0,0 +1,194 @@
+package httplog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// IdentityExtractor reads a single identity attribute, such as a user or
+// tenant identifier, from a request. It returns an empty string when the
+// attribute is not present.
+type IdentityExtractor func(*http.Request) string
+
+// IdentityFromHeader reads an identity attribute from a request header.
+func IdentityFromHeader(name string) IdentityExtractor {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// IdentityFromCookie reads an identity attribute from a request cookie.
+func IdentityFromCookie(name string) IdentityExtractor {
+	return func(r *http.Request) string {
+		var cookie, err = r.Cookie(name)
+		if err != nil {
+			return ""
+		}
+		return cookie.Value
+	}
+}
+
+// IdentityFromContext reads an identity attribute from a request context
+// value. The value must be either a string or a fmt.Stringer.
+func IdentityFromContext(key interface{}) IdentityExtractor {
+	return func(r *http.Request) string {
+		switch value := r.Context().Value(key).(type) {
+		case string:
+			return value
+		case fmt.Stringer:
+			return value.String()
+		default:
+			return ""
+		}
+	}
+}
+
+// IdentityFromJWTClaim reads an identity attribute from a top level claim of
+// the bearer token in the Authorization header. The token signature is NOT
+// verified so this must only be used behind a component that rejects invalid
+// tokens.
+func IdentityFromJWTClaim(claim string) IdentityExtractor {
+	return func(r *http.Request) string {
+		var scheme, token, ok = strings.Cut(r.Header.Get("Authorization"), " ")
+		if !ok || !strings.EqualFold(scheme, "bearer") {
+			return ""
+		}
+		var parts = strings.Split(token, ".")
+		if len(parts) != 3 {
+			return ""
+		}
+		var payload, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+		if err != nil {
+			return ""
+		}
+		var claims map[string]interface{}
+		var decoder = json.NewDecoder(bytes.NewReader(payload))
+		decoder.UseNumber()
+		if err = decoder.Decode(&claims); err != nil {
+			return ""
+		}
+		switch value := claims[claim].(type) {
+		case string:
+			return value
+		case json.Number:
+			return value.String()
+		default:
+			return ""
+		}
+	}
+}
+
+// AuthMethodFromAuthorization reports the lower case scheme of the
+// Authorization header, such as "bearer" or "basic".
+func AuthMethodFromAuthorization() IdentityExtractor {
+	return func(r *http.Request) string {
+		var scheme, _, _ = strings.Cut(r.Header.Get("Authorization"), " ")
+		return strings.ToLower(scheme)
+	}
+}
+
+// identityExtractors holds the configured extractors for each identity field
+// of the access log.
+type identityExtractors struct {
+	user       []IdentityExtractor
+	sessionID  []IdentityExtractor
+	tenantID   []IdentityExtractor
+	authMethod []IdentityExtractor
+	hashKey    []byte
+}
+
+func firstIdentity(r *http.Request, extractors []IdentityExtractor) string {
+	for _, extractor := range extractors {
+		if value := extractor(r); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// apply fills any identity field the handler did not set itself and then
+// hashes the identifying values if configured to do so.
+func (e identityExtractors) apply(r *http.Request, a *Access) {
+	for _, field := range []struct {
+		value      *string
+		extractors []IdentityExtractor
+	}{
+		{&a.User, e.user},
+		{&a.SessionID, e.sessionID},
+		{&a.TenantID, e.tenantID},
+		{&a.AuthMethod, e.authMethod},
+	} {
+		if *field.value == "" {
+			*field.value = firstIdentity(r, field.extractors)
+		}
+	}
+	if e.hashKey == nil {
+		return
+	}
+	for _, value := range []*string{&a.User, &a.SessionID, &a.TenantID} {
+		if *value != "" {
+			*value = hashIdentity(e.hashKey, *value)
+		}
+	}
+}
+
+func hashIdentity(key []byte, value string) string {
+	var mac = hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MiddlewareOptionUser sets the extractors used to populate the user field of
+// the access log. The first non-empty value wins. A value set by the handler
+// through SetUser always takes precedence.
+func MiddlewareOptionUser(extractors ...IdentityExtractor) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.identity.user = extractors
+		return m
+	}
+}
+
+// MiddlewareOptionSessionID sets the extractors used to populate the
+// session_id field of the access log. The first non-empty value wins.
+func MiddlewareOptionSessionID(extractors ...IdentityExtractor) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.identity.sessionID = extractors
+		return m
+	}
+}
+
+// MiddlewareOptionTenantID sets the extractors used to populate the
+// tenant_id field of the access log. The first non-empty value wins.
+func MiddlewareOptionTenantID(extractors ...IdentityExtractor) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.identity.tenantID = extractors
+		return m
+	}
+}
+
+// MiddlewareOptionAuthMethod sets the extractors used to populate the
+// auth_method field of the access log. The first non-empty value wins.
+func MiddlewareOptionAuthMethod(extractors ...IdentityExtractor) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.identity.authMethod = extractors
+		return m
+	}
+}
+
+// MiddlewareOptionHashIdentity replaces the user, session_id, and tenant_id
+// values in the access log with a hex encoded HMAC-SHA256 of the original
+// value using the given key. This allows correlating requests from the same
+// identity without logging the identity itself.
+func MiddlewareOptionHashIdentity(key []byte) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.identity.hashKey = key
+		return m
+	}
+}
@@ -0,0 +1,95 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type identityKey struct{}
+
+func TestIdentityExtractors(t *testing.T) {
+	var payload = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"user-1","tid":42}`))
+	var req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer header."+payload+".signature")
+	req.Header.Set("X-Tenant", "tenant-1")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "session-1"})
+	req = req.WithContext(context.WithValue(req.Context(), identityKey{}, "ctx-user"))
+
+	var tc = []struct {
+		name      string
+		extractor IdentityExtractor
+		expected  string
+	}{
+		{"header", IdentityFromHeader("X-Tenant"), "tenant-1"},
+		{"missing header", IdentityFromHeader("X-Missing"), ""},
+		{"cookie", IdentityFromCookie("session"), "session-1"},
+		{"missing cookie", IdentityFromCookie("missing"), ""},
+		{"context", IdentityFromContext(identityKey{}), "ctx-user"},
+		{"missing context", IdentityFromContext("missing"), ""},
+		{"jwt string claim", IdentityFromJWTClaim("sub"), "user-1"},
+		{"jwt number claim", IdentityFromJWTClaim("tid"), "42"},
+		{"jwt missing claim", IdentityFromJWTClaim("missing"), ""},
+		{"auth method", AuthMethodFromAuthorization(), "bearer"},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if actual := c.extractor(req); actual != c.expected {
+				t.Fatalf("expected %q but got %q", c.expected, actual)
+			}
+		})
+	}
+
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	if actual := IdentityFromJWTClaim("sub")(req); actual != "" {
+		t.Fatalf("JWT extractor read a non-bearer credential: %q", actual)
+	}
+}
+
+func TestMiddlewareOptionIdentity(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var key = []byte("secret")
+	var result = NewMiddleware(
+		MiddlewareOptionUser(IdentityFromHeader("X-Missing"), IdentityFromHeader("X-User")),
+		MiddlewareOptionSessionID(IdentityFromCookie("session")),
+		MiddlewareOptionTenantID(IdentityFromHeader("X-Tenant")),
+		MiddlewareOptionAuthMethod(AuthMethodFromAuthorization()),
+		MiddlewareOptionHashIdentity(key),
+	)
+	var m = result(fixtureHandler{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req.Header.Set("X-User", "user-1")
+	req.Header.Set("X-Tenant", "tenant-1")
+	req.Header.Set("Authorization", "Basic dXNlcjpwYXNz")
+	req.AddCookie(&http.Cookie{Name: "session", Value: "session-1"})
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		if evt.User != hashIdentity(key, "user-1") {
+			t.Fatalf("MiddlewareOptionUser did not set a hashed user, %v", evt)
+		}
+		if evt.SessionID != hashIdentity(key, "session-1") {
+			t.Fatalf("MiddlewareOptionSessionID did not set a hashed session, %v", evt)
+		}
+		if evt.TenantID != hashIdentity(key, "tenant-1") {
+			t.Fatalf("MiddlewareOptionTenantID did not set a hashed tenant, %v", evt)
+		}
+		if evt.AuthMethod != "basic" {
+			t.Fatalf("MiddlewareOptionAuthMethod did not set the auth method, %v", evt)
+		}
+	})
+	m.ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,92 @@
+package httplog
+
+import (
+	"net/http"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// Levels at which access logs may be emitted.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+// MiddlewareOptionLevel sets the level of the access log. Responses with a
+// 5xx status are logged at serverErrorLevel instead. Unknown levels are
+// treated as LevelInfo, which is the default for both.
+func MiddlewareOptionLevel(level string, serverErrorLevel string) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.level = level
+		m.errorLevel = serverErrorLevel
+		return m
+	}
+}
+
+// MiddlewareOptionSampleRate emits only the given fraction, between 0 and 1,
+// of the access logs. Responses with a 5xx status, requests that recorded an
+// error, and requests to debug routes are always logged. The default rate of
+// 1 logs every request.
+func MiddlewareOptionSampleRate(rate float64) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.sampleRate = rate
+		return m
+	}
+}
+
+// isValidLevel reports whether the level is one of the known levels.
+func isValidLevel(level string) bool {
+	switch level {
+	case LevelDebug, LevelInfo, LevelWarn, LevelError:
+		return true
+	}
+	return false
+}
+
+// draw decides once per request whether it is kept by sampling so that its
+// heartbeats and final access log agree.
+func (m *Middleware) draw() bool {
+	return m.sampleRate >= 1 || m.sample() < m.sampleRate
+}
+
+// sampled reports whether an access log of the request should be emitted.
+func (m *Middleware) sampled(a Access, kept bool) bool {
+	return kept || a.Status >= 500 || a.Error != "" || a.Debug
+}
+
+// logAccess emits an access log through the logger after applying the
+// response tags and the fields supplied by the handler.
+func (m *Middleware) logAccess(logger logevent.Logger, r *http.Request, header http.Header, a Access, fields map[string]interface{}) {
+	for key, value := range m.responseTags {
+		logger.SetField(key, value(r, a.Status, header))
+	}
+	if len(fields) > 0 {
+		// Handler supplied fields belong only to this access log so they are
+		// applied to a copy rather than the logger shared with the handler.
+		logger = logger.Copy()
+		for key, value := range fields {
+			logger.SetField(key, value)
+		}
+	}
+	m.emit(logger, a.Status, m.record(r, a.Status, header, a))
+}
+
+// emit writes the access log at the level configured for its status.
+func (m *Middleware) emit(logger logevent.Logger, status int, event interface{}) {
+	var level = m.level
+	if status >= 500 {
+		level = m.errorLevel
+	}
+	switch level {
+	case LevelDebug:
+		logger.Debug(event)
+	case LevelWarn:
+		logger.Warn(event)
+	case LevelError:
+		logger.Error(event)
+	default:
+		logger.Info(event)
+	}
+}
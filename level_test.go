@@ -0,0 +1,71 @@
+package httplog
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func newLevelRequest(logger logevent.Logger) *http.Request {
+	var req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Add("X-Forwarded-Proto", "https")
+	req.Header.Add("X-Forwarded-Proto", "http")
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	return req.WithContext(logevent.NewContext(req.Context(), logger))
+}
+
+// expectAccessFields collects the optional fields set on the access log. The
+// access log is copied only when it has optional fields, so the copy is the
+// logger itself and the returned logger receives the access log either way.
+func expectAccessFields(ctrl *gomock.Controller, logger *MockLogger) (*MockLogger, map[string]interface{}) {
+	var fields = make(map[string]interface{})
+	logger.EXPECT().Copy().Return(logger).MaxTimes(1)
+	logger.EXPECT().SetField(gomock.Any(), gomock.Any()).Do(func(name string, value interface{}) {
+		fields[name] = value
+	}).AnyTimes()
+	return logger, fields
+}
+
+func TestMiddlewareOptionLevel(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware(MiddlewareOptionLevel(LevelDebug, LevelError))
+	logger.EXPECT().Debug(gomock.Any())
+	m(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+
+	logger.EXPECT().Error(gomock.Any())
+	m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+}
+
+func TestMiddlewareOptionSampleRate(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware(MiddlewareOptionSampleRate(0.5))(fixtureHandler{}).(*Middleware)
+	var draws = []float64{0.7, 0.2}
+	m.sample = func() float64 {
+		var draw = draws[0]
+		draws = draws[1:]
+		return draw
+	}
+	logger.EXPECT().Info(gomock.Any()).Times(1)
+	m.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+	m.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+
+	logger.EXPECT().Info(gomock.Any()).Times(1)
+	m.sample = func() float64 { return 0.9 }
+	m.next = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	m.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+}
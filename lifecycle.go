@@ -0,0 +1,220 @@
+package httplog
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// Phases of the service lifecycle reported in the phase field of a
+// LifecycleEvent.
+const (
+	LifecyclePhaseStarted  = "started"
+	LifecyclePhaseReady    = "ready"
+	LifecyclePhaseShutdown = "shutdown"
+	LifecyclePhaseDrained  = "drained"
+)
+
+// secretNames are the segments of a configuration, tag, or header name that
+// cause its value to be masked. Names are split into segments on "_", "-",
+// and "." so that api_key and X-Auth-Token are masked but keyspace and author
+// are not.
+var secretNames = map[string]bool{
+	"secret":        true,
+	"secrets":       true,
+	"password":      true,
+	"passwd":        true,
+	"token":         true,
+	"key":           true,
+	"apikey":        true,
+	"credential":    true,
+	"credentials":   true,
+	"auth":          true,
+	"authorization": true,
+	"cookie":        true,
+}
+
+// Lifecycle emits events marking the start, readiness, and shutdown of a
+// service. The middleware reports in-flight requests to the Lifecycle when it
+// is installed with MiddlewareOptionLifecycle so that the shutdown events can
+// report how many requests were drained:
+//
+//	var lifecycle = httplog.NewLifecycle(logger, options...)
+//	var server = &http.Server{
+//		Handler: httplog.NewMiddleware(append(options, httplog.MiddlewareOptionLifecycle(lifecycle))...)(mux),
+//	}
+//	lifecycle.Started(server.Addr)
+//	go server.ListenAndServe()
+//	lifecycle.Ready()
+//	...
+//	_ = lifecycle.Shutdown(ctx, server)
+type Lifecycle struct {
+	logger     logevent.Logger
+	middleware *Middleware
+	inFlight   int64
+}
+
+// NewLifecycle creates a Lifecycle that emits events to the given logger. The
+// options should be the same as those given to NewMiddleware. They populate
+// the Base fields of the events and the configuration reported at startup.
+func NewLifecycle(logger logevent.Logger, options ...MiddlewareOption) *Lifecycle {
+	var hostname, _ = os.Hostname()
+	return &Lifecycle{
+		logger:     logger,
+		middleware: newMiddleware(hostname, nil, options...),
+	}
+}
+
+// InFlight returns the number of requests currently being served by
+// middleware installed with MiddlewareOptionLifecycle.
+func (l *Lifecycle) InFlight() int64 {
+	return atomic.LoadInt64(&l.inFlight)
+}
+
+// Started emits the startup event with the effective middleware
+// configuration, the build information of the binary, and the addresses the
+// service listens on.
+func (l *Lifecycle) Started(listeners ...string) {
+	var event = l.event(LifecyclePhaseStarted)
+	event.Config = middlewareConfig(l.middleware)
+	event.Listeners = listeners
+	if info, ok := debug.ReadBuildInfo(); ok {
+		event.GoVersion = info.GoVersion
+		event.BuildPath = info.Main.Path
+		event.BuildVersion = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				event.BuildRevision = setting.Value
+			}
+		}
+	}
+	l.logger.Info(event)
+}
+
+// Ready emits an event marking that the service is ready to serve traffic.
+func (l *Lifecycle) Ready() {
+	l.logger.Info(l.event(LifecyclePhaseReady))
+}
+
+// Shutdown emits an event marking the start of shutdown, gracefully shuts
+// down the server, and then emits an event reporting how many in-flight
+// requests were drained and how long it took. The error of server.Shutdown
+// is returned and recorded in the final event.
+func (l *Lifecycle) Shutdown(ctx context.Context, server *http.Server) error {
+	var start = time.Now()
+	var inFlight = l.InFlight()
+	var event = l.event(LifecyclePhaseShutdown)
+	event.InFlight = inFlight
+	l.logger.Info(event)
+
+	var err = server.Shutdown(ctx)
+	var remaining = l.InFlight()
+	event = l.event(LifecyclePhaseDrained)
+	event.InFlight = remaining
+	if inFlight > remaining {
+		event.Drained = inFlight - remaining
+	}
+	event.Duration = int(time.Since(start).Milliseconds())
+	if err != nil {
+		event.Error = err.Error()
+		l.logger.Error(event)
+		return err
+	}
+	l.logger.Info(event)
+	return nil
+}
+
+func (l *Lifecycle) event(phase string) LifecycleEvent {
+	return LifecycleEvent{
+		Base:  l.middleware.base(),
+		Phase: phase,
+	}
+}
+
+func (l *Lifecycle) begin() {
+	atomic.AddInt64(&l.inFlight, 1)
+}
+
+func (l *Lifecycle) end() {
+	atomic.AddInt64(&l.inFlight, -1)
+}
+
+// MiddlewareOptionLifecycle reports the requests served by the middleware to
+// the Lifecycle so that shutdown can account for in-flight requests.
+func MiddlewareOptionLifecycle(l *Lifecycle) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.lifecycle = l
+		return m
+	}
+}
+
+// middlewareConfig describes the effective configuration of the middleware.
+// Values that may be secrets are masked.
+func middlewareConfig(m *Middleware) map[string]string {
+	var config = map[string]string{
+		"service":       m.service,
+		"version":       m.version,
+		"host":          m.host,
+		"env":           m.env,
+		"pod":           m.pod,
+		"namespace":     m.namespace,
+		"node":          m.node,
+		"container_id":  m.containerID,
+		"server_timing": strconv.FormatBool(m.serverTiming),
+		"heartbeat":     m.heartbeat.String(),
+		"abort_status":  strconv.Itoa(m.abortStatus),
+		"tls_verbosity": tlsVerbosityName(m.tlsVerbosity),
+		"fingerprint":   strconv.FormatBool(m.fingerprinter != nil),
+		"redacted":      strings.Join(m.redacted, ","),
+		"headers":       strings.Join(m.headers, ","),
+		"debug_routes":  strings.Join(m.debugRoutes, ","),
+		"level":         m.level,
+		"error_level":   m.errorLevel,
+		"sample_rate":   strconv.FormatFloat(m.sampleRate, 'f', -1, 64),
+		"trailers":      strings.Join(m.trailers, ","),
+	}
+	for key, value := range m.tags {
+		config["tag."+key] = fmt.Sprint(value)
+	}
+	var classes = make([]string, 0, len(m.errorClasses))
+	for _, class := range m.errorClasses {
+		classes = append(classes, class.name)
+	}
+	config["error_classes"] = strings.Join(classes, ",")
+	var trusted = make([]string, 0, len(m.queueTrusted))
+	for _, prefix := range m.queueTrusted {
+		trusted = append(trusted, prefix.String())
+	}
+	sort.Strings(trusted)
+	config["queue_trusted"] = strings.Join(trusted, ",")
+	if len(m.identity.hashKey) > 0 {
+		config["identity_hash_key"] = "REDACTED"
+	}
+	for key, value := range config {
+		config[key] = maskSecret(key, value)
+	}
+	return config
+}
+
+// maskSecret replaces the value if a segment of the name suggests that it is
+// a secret.
+func maskSecret(name string, value string) string {
+	var segments = strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for _, segment := range segments {
+		if secretNames[segment] {
+			return "REDACTED"
+		}
+	}
+	return value
+}
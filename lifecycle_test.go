@@ -0,0 +1,132 @@
+package httplog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestLifecycleStarted(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var lifecycle = NewLifecycle(logger,
+		MiddlewareOptionService("test"),
+		MiddlewareOptionTag("region", "us-east-1"),
+		MiddlewareOptionTag("api_token", "hunter2"),
+		MiddlewareOptionHashIdentity([]byte("hunter2")),
+	)
+	gomock.InOrder(
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			var evt, ok = event.(LifecycleEvent)
+			if !ok {
+				t.Fatalf("expected a LifecycleEvent but got %T", event)
+			}
+			if evt.Phase != LifecyclePhaseStarted || evt.Service != "test" {
+				t.Fatalf("unexpected startup event, %v", evt)
+			}
+			if len(evt.Listeners) != 1 || evt.Listeners[0] != ":8080" {
+				t.Fatalf("unexpected listeners %v", evt.Listeners)
+			}
+			if evt.Config["service"] != "test" || evt.Config["tag.region"] != "us-east-1" {
+				t.Fatalf("configuration missing from startup event, %v", evt.Config)
+			}
+			for key, value := range evt.Config {
+				if value == "hunter2" {
+					t.Fatalf("secret %s was not masked", key)
+				}
+			}
+			if evt.GoVersion == "" {
+				t.Fatal("build info missing from startup event")
+			}
+		}),
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			if evt := event.(LifecycleEvent); evt.Phase != LifecyclePhaseReady {
+				t.Fatalf("unexpected ready event, %v", evt)
+			}
+		}),
+	)
+	lifecycle.Started(":8080")
+	lifecycle.Ready()
+}
+
+func TestMaskSecret(t *testing.T) {
+	var tc = []struct {
+		name   string
+		masked bool
+	}{
+		{"api_key", true},
+		{"X-Auth-Token", true},
+		{"Authorization", true},
+		{"Set-Cookie", true},
+		{"db.password", true},
+		{"monkey_patch", false},
+		{"author", false},
+		{"keyspace", false},
+		{"X-Forwarded-Proto", false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			if masked := maskSecret(c.name, "value") == "REDACTED"; masked != c.masked {
+				t.Fatalf("expected masked %v but got %v", c.masked, masked)
+			}
+		})
+	}
+}
+
+func TestLifecycleShutdownDrains(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var lifecycle = NewLifecycle(logger)
+	var started = make(chan struct{})
+	var release = make(chan struct{})
+	var m = NewMiddleware(MiddlewareOptionLifecycle(lifecycle))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.ServeHTTP(w, r.WithContext(logevent.NewContext(r.Context(), logger)))
+	}))
+	defer server.Close()
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+		if resp, err := server.Client().Get(server.URL); err == nil {
+			_ = resp.Body.Close()
+		}
+	}()
+	<-started
+
+	gomock.InOrder(
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			var evt = event.(LifecycleEvent)
+			if evt.Phase != LifecyclePhaseShutdown || evt.InFlight != 1 {
+				t.Errorf("unexpected shutdown event, %v", evt)
+			}
+			close(release)
+		}),
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			if _, ok := event.(Access); !ok {
+				t.Errorf("expected an Access event but got %T", event)
+			}
+		}),
+		logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+			var evt = event.(LifecycleEvent)
+			if evt.Phase != LifecyclePhaseDrained || evt.InFlight != 0 || evt.Drained != 1 {
+				t.Errorf("unexpected drained event, %v", evt)
+			}
+		}),
+	)
+	if err := lifecycle.Shutdown(context.Background(), server.Config); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+}
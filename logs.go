@@ -2,39 +2,139 @@ package httplog
 
 // Base implements the core, developer schema that all events share.
 type Base struct {
-	Service   string   `logevent:"service"`
-	Schema    string   `logevent:"schema,default=developer"`
-	UGCDirty  []string `logevent:"ugc_dirty"`
-	Version   string   `logevent:"version"`
-	Host      string   `logevent:"host"`
-	Env       string   `logevent:"env"`
-	Time      string   `logevent:"time"`
-	RequestID string   `logevent:"request_id"`
+	Service     string   `logevent:"service"`
+	Schema      string   `logevent:"schema,default=developer"`
+	UGCDirty    []string `logevent:"ugc_dirty"`
+	Version     string   `logevent:"version"`
+	Host        string   `logevent:"host"`
+	Env         string   `logevent:"env"`
+	Pod         string   `logevent:"pod"`
+	Namespace   string   `logevent:"namespace"`
+	Node        string   `logevent:"node"`
+	ContainerID string   `logevent:"container_id"`
+	Time        string   `logevent:"time"`
+	RequestID   string   `logevent:"request_id"`
 }
 
 // Access implements the access log schema.
 type Access struct {
 	Base
-	Schema                 string `logevent:"schema,default=access"`
-	SourceIP               string `logevent:"src_ip"`
-	ForwardedFor           string `logevent:"forwarded_for"`
-	DestinationIP          string `logevent:"dest_ip"`
-	Site                   string `logevent:"site"`
-	HTTPRequestContentType string `logevent:"http_request_content_type"`
-	HTTPMethod             string `logevent:"http_method"`
-	HTTPReferrer           string `logevent:"http_referrer"`
-	HTTPUserAgent          string `logevent:"http_user_agent"`
-	URIPath                string `logevent:"uri_path"`
-	URIQuery               string `logevent:"uri_query"`
-	Scheme                 string `logevent:"scheme"`
-	Port                   int    `logevent:"port"`
-	Bytes                  int    `logevent:"bytes"`
-	BytesOut               int    `logevent:"bytes_out"`
-	BytesIn                int    `logevent:"bytes_in"`
-	Duration               int    `logevent:"duration"`
-	HTTPContentType        string `logevent:"http_content_type"`
-	Status                 int    `logevent:"status"`
-	Message                string `logevent:"message,default=access"`
+	Schema                 string             `logevent:"schema,default=access"`
+	SourceIP               string             `logevent:"src_ip"`
+	ForwardedFor           string             `logevent:"forwarded_for"`
+	DestinationIP          string             `logevent:"dest_ip"`
+	Site                   string             `logevent:"site"`
+	HTTPRequestContentType string             `logevent:"http_request_content_type"`
+	HTTPMethod             string             `logevent:"http_method"`
+	HTTPReferrer           string             `logevent:"http_referrer"`
+	HTTPUserAgent          string             `logevent:"http_user_agent"`
+	URIPath                string             `logevent:"uri_path"`
+	URIQuery               string             `logevent:"uri_query"`
+	Scheme                 string             `logevent:"scheme"`
+	Port                   int                `logevent:"port"`
+	Bytes                  int64              `logevent:"bytes"`
+	BytesOut               int64              `logevent:"bytes_out"`
+	BytesIn                int64              `logevent:"bytes_in"`
+	ContentLength          int64              `logevent:"content_length"`
+	Duration               int                `logevent:"duration"`
+	DurationMicros         int                `logevent:"duration_us"`
+	QueueDuration          int                `logevent:"queue_duration"`
+	TimeToFirstByte        int                `logevent:"ttfb_us"`
+	BodyReadDuration       int                `logevent:"body_read_us"`
+	WriteDuration          int                `logevent:"write_us"`
+	Timings                map[string]float64 `logevent:"timings"`
+	RequestHeaders         map[string]string  `logevent:"request_headers"`
+	HTTPContentType        string             `logevent:"http_content_type"`
+	Status                 int                `logevent:"status"`
+	Debug                  bool               `logevent:"debug"`
+	Route                  string             `logevent:"route"`
+	User                   string             `logevent:"user"`
+	SessionID              string             `logevent:"session_id"`
+	TenantID               string             `logevent:"tenant_id"`
+	AuthMethod             string             `logevent:"auth_method"`
+	Error                  string             `logevent:"error"`
+	ErrorType              string             `logevent:"error_type"`
+	ErrorClass             string             `logevent:"error_class"`
+	Message                string             `logevent:"message,default=access"`
+}
+
+// Session implements the schema for connections that the handler took over
+// from the HTTP server, such as WebSockets. It is emitted when the connection
+// is closed and covers only the traffic that followed the takeover.
+type Session struct {
+	Base
+	Schema   string `logevent:"schema,default=session"`
+	Upgraded string `logevent:"upgraded"`
+	SourceIP string `logevent:"src_ip"`
+	URIPath  string `logevent:"uri_path"`
+	BytesIn  int64  `logevent:"bytes_in"`
+	BytesOut int64  `logevent:"bytes_out"`
+	Duration int    `logevent:"duration"`
+	Message  string `logevent:"message,default=session"`
+}
+
+// Connection implements the schema for connections accepted by the HTTP
+// server. It is emitted once the server is done with the connection. The byte
+// counts are the sum of the request and response bodies served on it.
+type Connection struct {
+	Base
+	Schema       string `logevent:"schema,default=connection"`
+	ConnectionID string `logevent:"connection_id"`
+	SourceIP     string `logevent:"src_ip"`
+	Requests     int64  `logevent:"requests"`
+	BytesIn      int64  `logevent:"bytes_in"`
+	BytesOut     int64  `logevent:"bytes_out"`
+	Duration     int    `logevent:"duration"`
+	FinalState   string `logevent:"final_state"`
+	Message      string `logevent:"message,default=connection"`
+}
+
+// ServerError implements the schema for messages written by net/http to the
+// server ErrorLog. These are failures that happen outside of any handler and
+// so never reach the access log.
+type ServerError struct {
+	Base
+	Schema     string `logevent:"schema,default=server_error"`
+	ErrorClass string `logevent:"error_class"`
+	SourceIP   string `logevent:"src_ip"`
+	Error      string `logevent:"error"`
+	Stack      string `logevent:"stack"`
+	Message    string `logevent:"message,default=server_error"`
+}
+
+// LifecycleEvent implements the schema for the startup, readiness, and
+// shutdown of a service. The configuration and build fields are populated
+// only at startup and the drain fields only once shutdown has completed.
+type LifecycleEvent struct {
+	Base
+	Schema        string            `logevent:"schema,default=lifecycle"`
+	Phase         string            `logevent:"phase"`
+	Config        map[string]string `logevent:"config"`
+	GoVersion     string            `logevent:"go_version"`
+	BuildPath     string            `logevent:"build_path"`
+	BuildVersion  string            `logevent:"build_version"`
+	BuildRevision string            `logevent:"build_revision"`
+	Listeners     []string          `logevent:"listeners"`
+	InFlight      int64             `logevent:"in_flight"`
+	Drained       int64             `logevent:"drained"`
+	Duration      int               `logevent:"duration"`
+	Error         string            `logevent:"error"`
+	Message       string            `logevent:"message,default=lifecycle"`
+}
+
+// ConfigChange implements the schema for the audit of a runtime
+// configuration change. Changed lists the settings whose value differs and
+// Previous and Current hold their values. A rejected change records the
+// reason in Error and leaves the configuration unchanged.
+type ConfigChange struct {
+	Base
+	Schema   string            `logevent:"schema,default=config_change"`
+	Source   string            `logevent:"source"`
+	Changed  []string          `logevent:"changed"`
+	Previous map[string]string `logevent:"previous"`
+	Current  map[string]string `logevent:"current"`
+	Error    string            `logevent:"error"`
+	Message  string            `logevent:"message,default=config_change"`
 }
 
 // Event implements the schema for all service events. It can be embedded within
@@ -2,10 +2,13 @@ package httplog
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net"
 	"net/http"
+	"net/netip"
 	"os"
 	"strconv"
 	"sync/atomic"
@@ -23,16 +26,35 @@ var (
 
 type recordingReader struct {
 	io.ReadCloser
-	bytesRead *int32
+	bytesRead int64
+	readTime  int64
+	finished  int32
 }
 
-func (r *recordingReader) BytesRead() int {
-	return int(atomic.LoadInt32(r.bytesRead))
+func (r *recordingReader) BytesRead() int64 {
+	return atomic.LoadInt64(&r.bytesRead)
+}
+
+// ReadDuration returns the total time spent blocked in calls to Read.
+func (r *recordingReader) ReadDuration() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.readTime))
+}
+
+// Finished reports whether a call to Read returned io.EOF or
+// io.ErrUnexpectedEOF, meaning that the body itself ended. Other errors, such
+// as a failed read, leave the body unfinished.
+func (r *recordingReader) Finished() bool {
+	return atomic.LoadInt32(&r.finished) == 1
 }
 
 func (r *recordingReader) Read(p []byte) (int, error) {
+	var start = time.Now()
 	var n, e = r.ReadCloser.Read(p)
-	atomic.AddInt32(r.bytesRead, int32(n)) // nolint:gosec // G115: n from Read() is always non-negative
+	atomic.AddInt64(&r.readTime, int64(time.Since(start)))
+	atomic.AddInt64(&r.bytesRead, int64(n))
+	if errors.Is(e, io.EOF) || errors.Is(e, io.ErrUnexpectedEOF) {
+		atomic.StoreInt32(&r.finished, 1)
+	}
 	return n, e
 }
 
@@ -44,27 +66,60 @@ type Middleware struct {
 	version       string
 	host          string
 	env           string
+	pod           string
+	namespace     string
+	node          string
+	containerID   string
 	tags          map[string]interface{}
+	tagFuncs      map[string]func(*http.Request) interface{}
+	responseTags  map[string]func(*http.Request, int, http.Header) interface{}
 	redacted      []string
+	identity      identityExtractors
+	errorClasses  []errorClass
+	queueTrusted  []netip.Prefix
+	serverTiming  bool
+	trailers      []string
+	heartbeat     time.Duration
+	abortStatus   int
+	tlsVerbosity  TLSVerbosity
+	fingerprinter *Fingerprinter
+	lifecycle     *Lifecycle
+	level         string
+	errorLevel    string
+	sampleRate    float64
+	sample        func() float64
+	headers       []string
+	debugRoutes   []string
+	recorder      *Recorder
+	tail          *Tail
+	record        func(*http.Request, int, http.Header, Access) interface{}
 	requestID     func(*http.Request) string
 	transactionID func(context.Context) string
 	next          http.Handler
 }
 
 func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.serve(w, r, m.next)
+}
+
+// serve logs the request while it is handled by next. The settings of the
+// Middleware are only read so that one value may serve many handlers.
+func (m *Middleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if m.lifecycle != nil {
+		m.lifecycle.begin()
+		defer m.lifecycle.end()
+	}
 	for key, value := range m.tags {
 		logevent.FromContext(r.Context()).SetField(key, value)
 	}
+	for key, value := range m.tagFuncs {
+		logevent.FromContext(r.Context()).SetField(key, value(r))
+	}
 	var srcIP, _, _ = net.SplitHostPort(r.RemoteAddr)
 	var dstIP, dstPortStr, _ = net.SplitHostPort(r.Context().Value(http.LocalAddrContextKey).(net.Addr).String())
 	var dstPort, _ = strconv.Atoi(dstPortStr)
-	var base = Base{
-		Service:   m.service,
-		Version:   m.version,
-		Host:      m.host,
-		Env:       m.env,
-		RequestID: m.requestID(r),
-	}
+	var base = m.base()
+	base.RequestID = m.requestID(r)
 
 	var query = r.URL.Query()
 	for _, parameter := range m.redacted {
@@ -87,27 +142,125 @@ func (m *Middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		URIQuery:               query.Encode(),
 		Scheme:                 r.URL.Scheme,
 		Port:                   dstPort,
+		ContentLength:          r.ContentLength,
+		RequestHeaders:         captureHeaders(m.headers, r.Header),
+		QueueDuration:          int(m.queueDuration(r, time.Now()).Milliseconds()),
 	}
 
-	r = r.WithContext(
-		context.WithValue(
-			context.WithValue(r.Context(), ctxKeyTransactionID, m.transactionID),
-			ctxKeyBase,
-			base,
-		),
-	)
-	var wrapper = wrapWriter(w, r.ProtoMajor)
-	var bodyWrapper = &recordingReader{r.Body, new(int32)}
+	var record = newAccessRecord(access, m.errorClasses)
+	for key, value := range tlsFields(r.TLS, m.tlsVerbosity) {
+		record.setField(key, value)
+	}
+	if m.fingerprinter != nil && r.TLS != nil {
+		if fingerprint := fingerprintFromContext(r.Context()); fingerprint != "" {
+			record.setField("tls_fingerprint", fingerprint)
+		}
+	}
+	var conn = connStatsFromContext(r.Context())
+	if conn != nil {
+		record.setField("connection_id", conn.id)
+		record.setField("connection_request_index", conn.nextRequest())
+	}
+	var ctx = context.WithValue(r.Context(), ctxKeyTransactionID, m.transactionID)
+	ctx = context.WithValue(ctx, ctxKeyBase, base)
+	ctx = context.WithValue(ctx, ctxKeyAccessRecord, record)
+	if m.tail != nil {
+		ctx = logevent.NewContext(ctx, &tailLogger{Logger: logevent.FromContext(ctx), tail: m.tail, record: record})
+	}
+	r = r.WithContext(ctx)
+	var wrapper = wrapWriter(w)
+	var bodyWrapper = &recordingReader{ReadCloser: r.Body}
 	r.Body = bodyWrapper
 	var start = time.Now()
-	m.next.ServeHTTP(wrapper, r)
-	access.Duration = int(time.Since(start).Nanoseconds() / 1e6)
-	access.BytesOut = wrapper.BytesWritten()
-	access.BytesIn = bodyWrapper.BytesRead()
-	access.Bytes = access.BytesIn + access.BytesOut
-	access.HTTPContentType = wrapper.Header().Get("Content-Type")
-	access.Status = wrapper.Status()
-	logevent.FromContext(r.Context()).Info(access)
+	if m.serverTiming {
+		addServerTimingHeader(wrapper, record, start)
+	}
+	trackHijack(wrapper, r, base)
+	var kept = m.draw()
+	var stopHeartbeat = m.startHeartbeat(r, record, wrapper, bodyWrapper, start, kept)
+	defer stopHeartbeat()
+	next.ServeHTTP(wrapper, r)
+	if m.serverTiming && !wrapper.Hijacked() {
+		// The server sends the header of a handler that wrote nothing only
+		// after it returns, which bypasses the Server-Timing hook.
+		wrapper.maybeWriteHeader()
+	}
+	stopHeartbeat()
+	var final, fields = record.finish(func(a *Access, fields map[string]interface{}) {
+		m.complete(a, fields, r, wrapper, bodyWrapper, start)
+	})
+	if conn != nil {
+		conn.add(final.BytesIn, final.BytesOut)
+	}
+	if m.recorder != nil {
+		m.recorder.add(final)
+	}
+	if m.tail != nil {
+		m.tail.publishAccess(final)
+	}
+	if !m.sampled(final, kept) {
+		return
+	}
+	m.logAccess(logevent.FromContext(r.Context()), r, wrapper.Header(), final, fields)
+}
+
+// complete fills the access log fields that are only known once the handler
+// has returned. Fields that only apply to some responses, such as those that
+// were upgraded, are added to fields when they apply.
+func (m *Middleware) complete(a *Access, fields map[string]interface{}, r *http.Request, wrapper writerProxy, bodyWrapper *recordingReader, start time.Time) {
+	fillProgress(a, fields, wrapper, bodyWrapper, start)
+	a.TimeToFirstByte = a.DurationMicros
+	if headerAt := wrapper.HeaderWrittenAt(); !headerAt.IsZero() {
+		a.TimeToFirstByte = int(headerAt.Sub(start).Microseconds())
+		if lastWriteAt := wrapper.LastWriteAt(); lastWriteAt.After(headerAt) {
+			a.WriteDuration = int(lastWriteAt.Sub(headerAt).Microseconds())
+		}
+	}
+	a.BodyReadDuration = int(bodyWrapper.ReadDuration().Microseconds())
+	// A body that ended before reaching the declared length was truncated,
+	// usually because the client went away mid upload. Handlers that stop
+	// reading early, such as after a MaxBytesReader limit, never see the end
+	// of the body and are not reported.
+	if a.ContentLength >= 0 && bodyWrapper.Finished() && a.BytesIn != a.ContentLength {
+		fields["content_length_mismatch"] = true
+	}
+	a.HTTPContentType = wrapper.Header().Get("Content-Type")
+	a.Status = wrapper.Status()
+	if informational := wrapper.InformationalStatuses(); len(informational) > 0 {
+		fields["informational_statuses"] = informational
+	}
+	if trailers := captureTrailers(m.trailers, wrapper.Header()); len(trailers) > 0 {
+		fields["trailers"] = trailers
+	}
+	var hijacked = wrapper.Hijacked()
+	var upgraded string
+	if hijacked || a.Status == http.StatusSwitchingProtocols {
+		upgraded = upgradeProtocol(r)
+	}
+	if upgraded != "" {
+		fields["upgraded"] = upgraded
+	}
+	if hijacked {
+		fields["hijacked"] = true
+		// A handler that hijacks the connection writes its own status line,
+		// if any, so the default of 200 would be wrong. An upgrade is assumed
+		// to have been accepted.
+		if wrapper.HeaderWrittenAt().IsZero() {
+			a.Status = 0
+			if upgraded != "" {
+				a.Status = http.StatusSwitchingProtocols
+			}
+		}
+	}
+	if a.Error == "" {
+		a.Error = wrapper.ErrorMessage()
+	}
+	m.recordAbort(a, fields, r, wrapper.WriteError())
+	m.identity.apply(r, a)
+	if m.isDebugRoute(a) {
+		a.Debug = true
+		a.RequestHeaders = debugHeaders(r.Header)
+	}
 }
 
 // MiddlewareOption is used to configure the HTTP server middleware.
@@ -121,6 +274,25 @@ func MiddlewareOptionTag(tagName string, tagValue interface{}) MiddlewareOption
 	}
 }
 
+// MiddlewareOptionTagFunc applies a key/value pair to all logs where the value
+// is computed from each incoming request before the handler is called.
+func MiddlewareOptionTagFunc(tagName string, tagValue func(*http.Request) interface{}) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.tagFuncs[tagName] = tagValue
+		return m
+	}
+}
+
+// MiddlewareOptionResponseTagFunc applies a key/value pair to the access log
+// where the value is computed after the handler returns. The function is given
+// the final response status and headers in addition to the request.
+func MiddlewareOptionResponseTagFunc(tagName string, tagValue func(r *http.Request, status int, header http.Header) interface{}) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.responseTags[tagName] = tagValue
+		return m
+	}
+}
+
 // MiddlewareOptionService sets the name of the running service as it will
 // appear in the logs. The default value is the hostname of the system.
 func MiddlewareOptionService(name string) MiddlewareOption {
@@ -193,21 +365,56 @@ func MiddlewareOptionRedactParameter(name string) MiddlewareOption {
 func NewMiddleware(options ...MiddlewareOption) func(http.Handler) http.Handler {
 	var hostname, _ = os.Hostname()
 	return func(next http.Handler) http.Handler {
-		var m = &Middleware{
-			service:       hostname,
-			version:       "latest",
-			host:          hostname,
-			env:           "production",
-			tags:          make(map[string]interface{}),
-			redacted:      []string{},
-			requestID:     func(*http.Request) string { return fmt.Sprintf("%X", int64(0)) },
-			transactionID: func(context.Context) string { return fmt.Sprintf("%X", int64(0)) },
-			next:          next,
-		}
-		for _, option := range options {
-			m = option(m)
-		}
-		return m
+		return newMiddleware(hostname, next, options...)
+	}
+}
+
+// newMiddleware applies the options on top of the default settings.
+func newMiddleware(hostname string, next http.Handler, options ...MiddlewareOption) *Middleware {
+	var m = &Middleware{
+		service:       hostname,
+		version:       "latest",
+		host:          hostname,
+		env:           "production",
+		tags:          make(map[string]interface{}),
+		tagFuncs:      make(map[string]func(*http.Request) interface{}),
+		responseTags:  make(map[string]func(*http.Request, int, http.Header) interface{}),
+		redacted:      []string{},
+		tlsVerbosity:  TLSVerbosityBasic,
+		level:         LevelInfo,
+		errorLevel:    LevelInfo,
+		sampleRate:    1,
+		sample:        rand.Float64,
+		requestID:     func(*http.Request) string { return fmt.Sprintf("%X", int64(0)) },
+		transactionID: func(context.Context) string { return fmt.Sprintf("%X", int64(0)) },
+		record:        func(_ *http.Request, _ int, _ http.Header, access Access) interface{} { return access },
+		next:          next,
+	}
+	for _, option := range options {
+		m = option(m)
+	}
+	return m
+}
+
+// baseFromOptions returns the Base fields that a middleware created with the
+// same options would apply. It allows events that are not tied to a request
+// to carry the same service, host, environment, and version.
+func baseFromOptions(options ...MiddlewareOption) Base {
+	var hostname, _ = os.Hostname()
+	return newMiddleware(hostname, nil, options...).base()
+}
+
+// base returns the Base fields shared by every event.
+func (m *Middleware) base() Base {
+	return Base{
+		Service:     m.service,
+		Version:     m.version,
+		Host:        m.host,
+		Env:         m.env,
+		Pod:         m.pod,
+		Namespace:   m.namespace,
+		Node:        m.node,
+		ContainerID: m.containerID,
 	}
 }
 
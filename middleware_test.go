@@ -3,11 +3,15 @@ package httplog
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"testing/iotest"
+	"time"
 
 	"github.com/asecurityteam/logevent/v2"
 	"github.com/golang/mock/gomock"
@@ -95,3 +99,153 @@ func TestMiddlewareOptionTransactionID(t *testing.T) {
 	logger.EXPECT().Info(gomock.Any())
 	m.ServeHTTP(httptest.NewRecorder(), req)
 }
+
+type fixtureHandlerStatus struct{}
+
+func (fixtureHandlerStatus) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Canary", "build-2")
+	w.WriteHeader(http.StatusTeapot)
+}
+
+func TestMiddlewareOptionTagFuncs(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var result = NewMiddleware(
+		MiddlewareOptionTagFunc("tenant", func(r *http.Request) interface{} { return r.Header.Get("X-Tenant") }),
+		MiddlewareOptionResponseTagFunc("canary", func(r *http.Request, status int, header http.Header) interface{} {
+			if status != http.StatusTeapot {
+				t.Errorf("response tag function received status %d", status)
+			}
+			return header.Get("X-Canary")
+		}),
+	)
+	var m = result(fixtureHandlerStatus{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req.Header.Set("X-Tenant", "tenant-a")
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+	gomock.InOrder(
+		logger.EXPECT().SetField("tenant", "tenant-a"),
+		logger.EXPECT().SetField("canary", "build-2"),
+		logger.EXPECT().Info(gomock.Any()),
+	)
+	m.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+type fixtureSlowReader struct {
+	delay time.Duration
+}
+
+func (r fixtureSlowReader) Read(p []byte) (int, error) {
+	time.Sleep(r.delay)
+	return 0, io.EOF
+}
+
+type fixtureHandlerTiming struct {
+	delay time.Duration
+}
+
+func (h fixtureHandlerTiming) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.ReadAll(r.Body)
+	time.Sleep(h.delay)
+	w.WriteHeader(http.StatusOK)
+	time.Sleep(h.delay)
+	_, _ = w.Write([]byte(`done`))
+}
+
+func TestMiddlewareTimingBreakdown(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var delay = 5 * time.Millisecond
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware()(fixtureHandlerTiming{delay: delay}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodPost, "/", io.NopCloser(fixtureSlowReader{delay: delay}))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		var minimum = int(delay.Microseconds())
+		if evt.BodyReadDuration < minimum {
+			t.Fatalf("body read time was not recorded, %v", evt)
+		}
+		if evt.TimeToFirstByte < 2*minimum {
+			t.Fatalf("time to first byte did not include the body read and handler delay, %v", evt)
+		}
+		if evt.WriteDuration < minimum {
+			t.Fatalf("write time was not recorded, %v", evt)
+		}
+		if evt.DurationMicros < evt.TimeToFirstByte+evt.WriteDuration {
+			t.Fatalf("total duration is less than its parts, %v", evt)
+		}
+		if evt.Duration != evt.DurationMicros/1000 {
+			t.Fatalf("millisecond duration does not match microsecond duration, %v", evt)
+		}
+	})
+	m.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestRecordingReaderCountsBeyond32Bits(t *testing.T) {
+	var reader = &recordingReader{ReadCloser: io.NopCloser(bytes.NewBufferString(`TEST`)), bytesRead: math.MaxInt32}
+	_, _ = io.ReadAll(reader)
+	if reader.BytesRead() != math.MaxInt32+4 {
+		t.Fatalf("Expected %d bytes read. Got %d", int64(math.MaxInt32)+4, reader.BytesRead())
+	}
+}
+
+type fixtureHandlerReadBody struct{}
+
+func (fixtureHandlerReadBody) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	_, _ = io.ReadAll(r.Body)
+}
+
+type fixtureHandlerLimitBody struct{}
+
+func (fixtureHandlerLimitBody) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 2)); err != nil {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestMiddlewareContentLengthMismatch(t *testing.T) {
+	var tc = []struct {
+		name     string
+		handler  http.Handler
+		body     io.Reader
+		expected bool
+	}{
+		{"complete", fixtureHandlerReadBody{}, bytes.NewBufferString(`TEST`), false},
+		{"truncated", fixtureHandlerReadBody{}, io.MultiReader(bytes.NewBufferString(`TE`), iotest.ErrReader(io.ErrUnexpectedEOF)), true},
+		{"short", fixtureHandlerReadBody{}, bytes.NewBufferString(`TE`), true},
+		{"read error", fixtureHandlerReadBody{}, io.MultiReader(bytes.NewBufferString(`TE`), iotest.ErrReader(errors.New("read failed"))), false},
+		{"limited", fixtureHandlerLimitBody{}, bytes.NewBufferString(`TEST`), false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var logger = NewMockLogger(ctrl)
+			var m = NewMiddleware()(c.handler).(*Middleware)
+			var req = httptest.NewRequest(http.MethodPost, "/", io.NopCloser(c.body))
+			req.ContentLength = 4
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+			req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+			var accessLogger, fields = expectAccessFields(ctrl, logger)
+			accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+				if evt := event.(Access); evt.ContentLength != 4 {
+					t.Fatalf("unexpected content length, %v", evt)
+				}
+			})
+			m.ServeHTTP(httptest.NewRecorder(), req)
+			if mismatch := fields["content_length_mismatch"] == true; mismatch != c.expected {
+				t.Fatalf("unexpected content length mismatch, %v", fields)
+			}
+		})
+	}
+}
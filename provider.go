@@ -0,0 +1,167 @@
+package httplog
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+)
+
+// cgroupPath and mountinfoPath are the files used to detect the container ID.
+var (
+	cgroupPath    = "/proc/self/cgroup"
+	mountinfoPath = "/proc/self/mountinfo"
+)
+
+// containerIDPattern matches the 64 character hexadecimal ID that container
+// runtimes use in the cgroup paths of a container.
+var containerIDPattern = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// mountinfoContainerIDPattern matches the ID in the directories that Docker
+// and Podman bind mount files such as /etc/hostname from. Only the directory
+// of the container is used because other mounts, such as those of a
+// Kubernetes pod sandbox, carry the IDs of other containers.
+var mountinfoContainerIDPattern = regexp.MustCompile(`containers/([0-9a-f]{64})/`)
+
+// BaseProvider fills fields of the Base shared by every event. Providers
+// leave fields untouched when they have nothing to contribute.
+type BaseProvider func(*Base)
+
+// MiddlewareOptionBase applies the providers, in order, to the Base fields of
+// the middleware. Providers only see the options given before them so that
+// later options, such as MiddlewareOptionVersion, take precedence.
+func MiddlewareOptionBase(providers ...BaseProvider) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		var base = m.base()
+		for _, provider := range providers {
+			provider(&base)
+		}
+		m.service = base.Service
+		m.version = base.Version
+		m.host = base.Host
+		m.env = base.Env
+		m.pod = base.Pod
+		m.namespace = base.Namespace
+		m.node = base.Node
+		m.containerID = base.ContainerID
+		return m
+	}
+}
+
+// BaseFromBuildInfo sets the version from the build information embedded in
+// the binary. The module version is used when the binary was built from a
+// released module. Otherwise the VCS revision is used with a "-dirty" suffix
+// if the working tree had local modifications.
+func BaseFromBuildInfo() BaseProvider {
+	return func(b *Base) {
+		var info, ok = debug.ReadBuildInfo()
+		if !ok {
+			return
+		}
+		if version := buildVersion(info); version != "" {
+			b.Version = version
+		}
+	}
+}
+
+func buildVersion(info *debug.BuildInfo) string {
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	var revision string
+	var modified bool
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value == "true"
+		}
+	}
+	if revision != "" && modified {
+		return revision + "-dirty"
+	}
+	return revision
+}
+
+// BaseFromEnvironment sets the service, version, and environment from the
+// environment variables commonly used by deployment tooling. The first
+// non-empty variable wins:
+//
+//	service: OTEL_SERVICE_NAME, DD_SERVICE, SERVICE_NAME
+//	version: DD_VERSION, SERVICE_VERSION
+//	env:     DD_ENV, DEPLOYMENT_ENVIRONMENT, ENV
+func BaseFromEnvironment() BaseProvider {
+	return func(b *Base) {
+		setFromEnv(&b.Service, "OTEL_SERVICE_NAME", "DD_SERVICE", "SERVICE_NAME")
+		setFromEnv(&b.Version, "DD_VERSION", "SERVICE_VERSION")
+		setFromEnv(&b.Env, "DD_ENV", "DEPLOYMENT_ENVIRONMENT", "ENV")
+	}
+}
+
+// BaseFromKubernetes sets the pod, namespace, and node from the POD_NAME,
+// POD_NAMESPACE, and NODE_NAME environment variables. These must be exposed
+// to the container through the Kubernetes downward API.
+func BaseFromKubernetes() BaseProvider {
+	return func(b *Base) {
+		setFromEnv(&b.Pod, "POD_NAME")
+		setFromEnv(&b.Namespace, "POD_NAMESPACE")
+		setFromEnv(&b.Node, "NODE_NAME")
+	}
+}
+
+// BaseFromContainer sets the container ID detected from /proc/self/cgroup.
+// Under cgroup v2 the cgroup path is usually "/" inside a container, so the
+// ID is read from the mounts listed in /proc/self/mountinfo instead. Nothing
+// is set when the process is not running in a container or the files are not
+// readable.
+func BaseFromContainer() BaseProvider {
+	return func(b *Base) {
+		var id = readContainerID(cgroupPath, containerIDFromCgroup)
+		if id == "" {
+			id = readContainerID(mountinfoPath, containerIDFromMountinfo)
+		}
+		if id != "" {
+			b.ContainerID = id
+		}
+	}
+}
+
+func readContainerID(path string, parse func(io.Reader) string) string {
+	var f, err = os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return parse(f)
+}
+
+func containerIDFromCgroup(r io.Reader) string {
+	var scanner = bufio.NewScanner(r)
+	for scanner.Scan() {
+		if id := containerIDPattern.FindString(scanner.Text()); id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func containerIDFromMountinfo(r io.Reader) string {
+	var scanner = bufio.NewScanner(r)
+	for scanner.Scan() {
+		if match := mountinfoContainerIDPattern.FindStringSubmatch(scanner.Text()); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+func setFromEnv(field *string, names ...string) {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			*field = value
+			return
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package httplog
+
+import (
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareOptionBase(t *testing.T) {
+	t.Setenv("DD_SERVICE", "")
+	t.Setenv("OTEL_SERVICE_NAME", "from-otel")
+	t.Setenv("SERVICE_NAME", "from-service-name")
+	t.Setenv("DD_VERSION", "1.2.3")
+	t.Setenv("DD_ENV", "staging")
+	t.Setenv("POD_NAME", "web-7d9f")
+	t.Setenv("POD_NAMESPACE", "payments")
+	t.Setenv("NODE_NAME", "node-1")
+
+	var m = newMiddleware("host", nil,
+		MiddlewareOptionBase(BaseFromEnvironment(), BaseFromKubernetes()),
+		MiddlewareOptionEnv("override"),
+	)
+	var base = m.base()
+	if base.Service != "from-otel" || base.Version != "1.2.3" || base.Env != "override" {
+		t.Fatalf("unexpected base from environment, %v", base)
+	}
+	if base.Pod != "web-7d9f" || base.Namespace != "payments" || base.Node != "node-1" || base.Host != "host" {
+		t.Fatalf("unexpected base from kubernetes, %v", base)
+	}
+}
+
+func TestBaseFromContainer(t *testing.T) {
+	var id = strings.Repeat("a1", 32)
+	var sandbox = strings.Repeat("b2", 32)
+	var tc = []struct {
+		name      string
+		cgroup    string
+		mountinfo string
+		expected  string
+	}{
+		{"cgroup v1", "12:pids:/\n11:memory:/docker/" + id + "\n0::/\n", "", id},
+		{
+			"cgroup v2",
+			"0::/\n",
+			"1432 1431 0:28 / / rw,relatime - overlay overlay rw\n" +
+				"1447 1432 8:1 /var/lib/containerd/io.containerd.grpc.v1.cri/sandboxes/" + sandbox + "/resolv.conf /etc/resolv.conf rw,relatime - ext4 /dev/sda1 rw\n" +
+				"1448 1432 8:1 /var/lib/docker/containers/" + id + "/hostname /etc/hostname rw,relatime - ext4 /dev/sda1 rw\n",
+			id,
+		},
+		{"not a container", "0::/\n", "1432 1431 0:28 / / rw,relatime - ext4 /dev/sda1 rw\n", ""},
+		{"missing", "", "", ""},
+	}
+	var originalCgroup, originalMountinfo = cgroupPath, mountinfoPath
+	defer func() { cgroupPath, mountinfoPath = originalCgroup, originalMountinfo }()
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var dir = t.TempDir()
+			cgroupPath = filepath.Join(dir, "cgroup")
+			mountinfoPath = filepath.Join(dir, "mountinfo")
+			if c.cgroup != "" {
+				if err := os.WriteFile(cgroupPath, []byte(c.cgroup), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.mountinfo != "" {
+				if err := os.WriteFile(mountinfoPath, []byte(c.mountinfo), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var base Base
+			BaseFromContainer()(&base)
+			if base.ContainerID != c.expected {
+				t.Fatalf("expected container %q but got %q", c.expected, base.ContainerID)
+			}
+		})
+	}
+}
+
+func TestBuildVersion(t *testing.T) {
+	var tests = []struct {
+		name     string
+		info     debug.BuildInfo
+		expected string
+	}{
+		{"module", debug.BuildInfo{Main: debug.Module{Version: "v1.4.0"}}, "v1.4.0"},
+		{"revision", debug.BuildInfo{Main: debug.Module{Version: "(devel)"}, Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "vcs.modified", Value: "false"}}}, "abc123"},
+		{"dirty", debug.BuildInfo{Settings: []debug.BuildSetting{{Key: "vcs.revision", Value: "abc123"}, {Key: "vcs.modified", Value: "true"}}}, "abc123-dirty"},
+		{"none", debug.BuildInfo{Main: debug.Module{Version: "(devel)"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if version := buildVersion(&tt.info); version != tt.expected {
+				t.Fatalf("expected %q but got %q", tt.expected, version)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package httplog
+
+import (
+	"math"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// queueSkewTolerance is how far in the future a queue start time may be
+	// before it is treated as invalid rather than as minor clock skew.
+	queueSkewTolerance = time.Second
+	// queueMaxDuration bounds the queue time that is believable. Anything
+	// larger is almost certainly a unit mismatch or a forged value.
+	queueMaxDuration = 10 * time.Minute
+)
+
+var queueHeaders = []string{"X-Request-Start", "X-Queue-Start"}
+
+// MiddlewareOptionQueueTime enables the queue_duration field of the access
+// log. The value is derived from the X-Request-Start or X-Queue-Start header
+// set by a load balancer or ingress proxy and reports the milliseconds the
+// request waited before reaching the service. The headers are only trusted
+// when the immediate peer address is within one of the given prefixes so that
+// clients cannot forge them.
+func MiddlewareOptionQueueTime(trusted ...netip.Prefix) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.queueTrusted = append(m.queueTrusted, trusted...)
+		return m
+	}
+}
+
+// queueDuration returns the time a request spent queued before it was
+// received by the middleware, or zero if it cannot be determined.
+func (m *Middleware) queueDuration(r *http.Request, received time.Time) time.Duration {
+	if len(m.queueTrusted) == 0 || !isTrustedPeer(r.RemoteAddr, m.queueTrusted) {
+		return 0
+	}
+	for _, header := range queueHeaders {
+		var queued, ok = parseQueueStart(r.Header.Get(header))
+		if !ok {
+			continue
+		}
+		var duration = received.Sub(queued)
+		if duration < -queueSkewTolerance || duration > queueMaxDuration {
+			// The value is not believable so fall through to the next
+			// header rather than logging a misleading duration.
+			continue
+		}
+		// Small negative values are clock skew between the proxy and the
+		// service and mean the request was not measurably queued.
+		return max(duration, 0)
+	}
+	return 0
+}
+
+func isTrustedPeer(remoteAddr string, trusted []netip.Prefix) bool {
+	var addrPort, err = netip.ParseAddrPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	var addr = addrPort.Addr().Unmap()
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseQueueStart converts a queue start header value into a time. Values
+// may be prefixed with "t=" and may be expressed as fractional seconds or as
+// whole seconds, milliseconds, microseconds, or nanoseconds since the epoch.
+// The unit of whole numbers is inferred from their magnitude.
+func parseQueueStart(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if fields := strings.FieldsFunc(value, func(r rune) bool { return r == ' ' || r == ',' }); len(fields) > 0 {
+		value = fields[0]
+	}
+	value = strings.TrimPrefix(value, "t=")
+	if value == "" {
+		return time.Time{}, false
+	}
+	if strings.Contains(value, ".") {
+		var seconds, err = strconv.ParseFloat(value, 64)
+		if err != nil || seconds <= 0 || math.IsInf(seconds, 0) {
+			return time.Time{}, false
+		}
+		var whole, fraction = math.Modf(seconds)
+		return time.Unix(int64(whole), int64(fraction*1e9)), true
+	}
+	var number, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return time.Time{}, false
+	}
+	switch {
+	case number < 1e11:
+		return time.Unix(number, 0), true
+	case number < 1e14:
+		return time.UnixMilli(number), true
+	case number < 1e17:
+		return time.UnixMicro(number), true
+	default:
+		return time.Unix(0, number), true
+	}
+}
@@ -0,0 +1,67 @@
+package httplog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseQueueStart(t *testing.T) {
+	var expected = time.Date(2024, 1, 2, 3, 4, 5, 678000000, time.UTC)
+	var tc = []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"fractional seconds", "t=" + strconv.FormatInt(expected.Unix(), 10) + ".678", true},
+		{"milliseconds", "t=" + strconv.FormatInt(expected.UnixMilli(), 10), true},
+		{"microseconds", "t=" + strconv.FormatInt(expected.UnixMicro(), 10), true},
+		{"nanoseconds", strconv.FormatInt(expected.UnixNano(), 10), true},
+		{"trailing fields", "t=" + strconv.FormatInt(expected.UnixMicro(), 10) + " D=123", true},
+		{"empty", "", false},
+		{"garbage", "t=soon", false},
+		{"negative", "t=-1", false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var actual, ok = parseQueueStart(c.value)
+			if ok != c.ok {
+				t.Fatalf("expected ok to be %t for %q", c.ok, c.value)
+			}
+			if ok && actual.Sub(expected).Abs() > time.Millisecond {
+				t.Fatalf("expected %s but got %s for %q", expected, actual, c.value)
+			}
+		})
+	}
+}
+
+func TestQueueDuration(t *testing.T) {
+	var received = time.Now()
+	var m = NewMiddleware(MiddlewareOptionQueueTime(netip.MustParsePrefix("192.0.2.0/24")))(fixtureHandler{}).(*Middleware)
+	var tc = []struct {
+		name       string
+		remoteAddr string
+		queued     time.Time
+		expected   time.Duration
+	}{
+		{"trusted", "192.0.2.1:1234", received.Add(-250 * time.Millisecond), 250 * time.Millisecond},
+		{"untrusted", "198.51.100.1:1234", received.Add(-250 * time.Millisecond), 0},
+		{"clock skew", "192.0.2.1:1234", received.Add(100 * time.Millisecond), 0},
+		{"future", "192.0.2.1:1234", received.Add(time.Hour), 0},
+		{"too old", "192.0.2.1:1234", received.Add(-time.Hour), 0},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var req = httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = c.remoteAddr
+			req.Header.Set("X-Request-Start", "t="+strconv.FormatInt(c.queued.UnixMicro(), 10))
+			var actual = m.queueDuration(req, received)
+			if (actual - c.expected).Abs() > time.Millisecond {
+				t.Fatalf("expected %s but got %s", c.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package httplog
+
+import (
+	"context"
+	"maps"
+	"sync"
+)
+
+var ctxKeyAccessRecord = ctxKey("_httplog_access_record")
+
+// accessRecord holds the in-flight Access value for a request. Handlers
+// enrich it through the context helpers while the middleware owns the final
+// emission. All methods are safe for concurrent use.
+type accessRecord struct {
+	lock    sync.Mutex
+	access  Access
+	fields  map[string]interface{}
+	classes []errorClass
+	done    bool
+}
+
+func newAccessRecord(access Access, classes []errorClass) *accessRecord {
+	return &accessRecord{access: access, fields: make(map[string]interface{}), classes: classes}
+}
+
+// update applies a change to the pending Access value. Changes made after
+// the record is finished are discarded because the log line is already gone.
+func (a *accessRecord) update(fn func(*Access)) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.done {
+		return
+	}
+	fn(&a.access)
+}
+
+func (a *accessRecord) setField(key string, value interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.done {
+		return
+	}
+	a.fields[key] = value
+}
+
+// snapshot returns a copy of the pending Access value and handler fields.
+// The maps and slices of the Access value are copied as well because the
+// handler may still change them while the copy is being logged.
+func (a *accessRecord) snapshot() (Access, map[string]interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var fields = make(map[string]interface{}, len(a.fields))
+	for key, value := range a.fields {
+		fields[key] = value
+	}
+	var access = a.access
+	access.Timings = maps.Clone(a.access.Timings)
+	access.RequestHeaders = maps.Clone(a.access.RequestHeaders)
+	return access, fields
+}
+
+// finish applies the final set of changes, closes the record to further
+// updates, and returns the values that should be logged. The change may add
+// fields that only apply to some responses.
+func (a *accessRecord) finish(fn func(*Access, map[string]interface{})) (Access, map[string]interface{}) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	fn(&a.access, a.fields)
+	a.done = true
+	return a.access, a.fields
+}
+
+func accessRecordFromContext(ctx context.Context) *accessRecord {
+	var record, _ = ctx.Value(ctxKeyAccessRecord).(*accessRecord)
+	return record
+}
+
+// SetAccessField adds an arbitrary key/value pair to the access log of the
+// request bound to the context. It does nothing if the context did not come
+// from a request handled by the middleware.
+func SetAccessField(ctx context.Context, key string, value interface{}) {
+	if record := accessRecordFromContext(ctx); record != nil {
+		record.setField(key, value)
+	}
+}
+
+// SetUser records the identity of the user making the request in the user
+// field of the access log.
+func SetUser(ctx context.Context, id string) {
+	if record := accessRecordFromContext(ctx); record != nil {
+		record.update(func(a *Access) { a.User = id })
+	}
+}
+
+// SetRoute records the route template that matched the request, such as
+// "/users/{id}", in the route field of the access log.
+func SetRoute(ctx context.Context, tmpl string) {
+	if record := accessRecordFromContext(ctx); record != nil {
+		record.update(func(a *Access) { a.Route = tmpl })
+	}
+}
+
+// SetError records the error that caused the request to fail in the error
+// field of the access log. The error_type field is set to the type of the
+// first wrapped error that is more than a generic wrapper or sentinel, such as
+// *fs.PathError, and the error_class field is set using the classes registered
+// with MiddlewareOptionErrorClass.
+func SetError(ctx context.Context, err error) {
+	if err == nil {
+		return
+	}
+	if record := accessRecordFromContext(ctx); record != nil {
+		record.update(func(a *Access) {
+			a.Error = err.Error()
+			a.ErrorType = errorType(err)
+			a.ErrorClass = classifyError(record.classes, err)
+		})
+	}
+}
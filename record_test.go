@@ -0,0 +1,84 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureHandlerEnrich struct{}
+
+func (fixtureHandlerEnrich) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i = i + 1 {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			SetAccessField(r.Context(), fmt.Sprintf("key%d", i%2), "value")
+			SetUser(r.Context(), "user")
+			SetRoute(r.Context(), "/users/{id}")
+			SetError(r.Context(), errors.New("failed"))
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestAccessRecordEnrichment(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var accessLogger = NewMockLogger(ctrl)
+	var m = NewMiddleware()(fixtureHandlerEnrich{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/users/1", io.NopCloser(bytes.NewBufferString(``)))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+	logger.EXPECT().Copy().Return(accessLogger)
+	accessLogger.EXPECT().SetField("key0", "value")
+	accessLogger.EXPECT().SetField("key1", "value")
+	accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		if evt.User != "user" {
+			t.Fatalf("SetUser did not update the access log, %v", evt)
+		}
+		if evt.Route != "/users/{id}" {
+			t.Fatalf("SetRoute did not update the access log, %v", evt)
+		}
+		if evt.Error != "failed" {
+			t.Fatalf("SetError did not update the access log, %v", evt)
+		}
+	})
+	m.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestAccessRecordIgnoresLateUpdates(t *testing.T) {
+	var record = newAccessRecord(Access{}, nil)
+	var final, _ = record.finish(func(a *Access, fields map[string]interface{}) { a.Status = http.StatusOK })
+	record.update(func(a *Access) { a.Status = http.StatusInternalServerError })
+	record.setField("late", true)
+	if final.Status != http.StatusOK || record.access.Status != http.StatusOK {
+		t.Fatal("record accepted an update after it was finished")
+	}
+	if len(record.fields) != 0 {
+		t.Fatal("record accepted a field after it was finished")
+	}
+}
+
+func TestAccessRecordHelpersWithoutMiddleware(t *testing.T) {
+	var ctx = context.Background()
+	SetAccessField(ctx, "key", "value")
+	SetUser(ctx, "user")
+	SetRoute(ctx, "/")
+	SetError(ctx, errors.New("failed"))
+}
@@ -0,0 +1,97 @@
+package httplog
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Recorder keeps the most recent access records in memory for
+// troubleshooting a single instance. Records are kept whether or not their
+// access log was sampled out.
+type Recorder struct {
+	lock    sync.Mutex
+	records []Access
+	next    int
+	full    bool
+}
+
+// NewRecorder creates a Recorder that holds the last size access records.
+func NewRecorder(size int) *Recorder {
+	if size < 1 {
+		size = 1
+	}
+	return &Recorder{records: make([]Access, size)}
+}
+
+func (r *Recorder) add(a Access) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records[r.next] = a
+	r.next = (r.next + 1) % len(r.records)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// Records returns the recorded access records, oldest first.
+func (r *Recorder) Records() []Access {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if !r.full {
+		return append([]Access(nil), r.records[:r.next]...)
+	}
+	return append(append([]Access(nil), r.records[r.next:]...), r.records[:r.next]...)
+}
+
+// MiddlewareOptionRecorder keeps every access record in the Recorder.
+func MiddlewareOptionRecorder(r *Recorder) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.recorder = r
+		return m
+	}
+}
+
+// recordFields returns the fields of an event keyed by their logevent names
+// so that they can be rendered in the same shape as the logs. Fields of
+// embedded structs are flattened with the outer fields taking precedence and
+// empty strings are replaced by their declared default.
+func recordFields(event interface{}) map[string]interface{} {
+	var fields = make(map[string]interface{})
+	addRecordFields(fields, reflect.ValueOf(event))
+	return fields
+}
+
+func addRecordFields(fields map[string]interface{}, value reflect.Value) {
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+	var embedded []reflect.Value
+	var valueType = value.Type()
+	for x := 0; x < valueType.NumField(); x = x + 1 {
+		var field = valueType.Field(x)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			embedded = append(embedded, value.Field(x))
+			continue
+		}
+		var tag, ok = field.Tag.Lookup("logevent")
+		if !ok || !field.IsExported() {
+			continue
+		}
+		var name, options, _ = strings.Cut(tag, ",")
+		var fieldValue = value.Field(x).Interface()
+		if defaultValue, found := strings.CutPrefix(options, "default="); found && value.Field(x).IsZero() && field.Type.Kind() == reflect.String {
+			fieldValue = defaultValue
+		}
+		fields[name] = fieldValue
+	}
+	for _, inner := range embedded {
+		var innerFields = make(map[string]interface{})
+		addRecordFields(innerFields, inner)
+		for name, fieldValue := range innerFields {
+			if _, ok := fields[name]; !ok {
+				fields[name] = fieldValue
+			}
+		}
+	}
+}
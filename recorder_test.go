@@ -0,0 +1,29 @@
+package httplog
+
+import (
+	"testing"
+)
+
+func TestRecorderKeepsLatest(t *testing.T) {
+	var recorder = NewRecorder(2)
+	if records := recorder.Records(); len(records) != 0 {
+		t.Fatalf("expected no records but got %d", len(records))
+	}
+	for _, path := range []string{"/a", "/b", "/c"} {
+		recorder.add(Access{URIPath: path})
+	}
+	var records = recorder.Records()
+	if len(records) != 2 || records[0].URIPath != "/b" || records[1].URIPath != "/c" {
+		t.Fatalf("unexpected records %v", records)
+	}
+}
+
+func TestRecordFields(t *testing.T) {
+	var fields = recordFields(Access{Base: Base{Service: "test"}, Status: 200})
+	if fields["service"] != "test" || fields["status"] != 200 {
+		t.Fatalf("unexpected fields %v", fields)
+	}
+	if fields["schema"] != "access" || fields["message"] != "access" {
+		t.Fatalf("defaults or precedence not applied, schema %v message %v", fields["schema"], fields["message"])
+	}
+}
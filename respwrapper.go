@@ -5,6 +5,9 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // Copyright (c) 2015-present Peter Kieltyka (https://github.com/pkieltyka), Google Inc.
@@ -35,8 +38,48 @@ type writerProxy interface {
 	// Status returns the HTTP status of the request, or 0 if one has not
 	// yet been sent.
 	Status() int
-	// BytesWritten returns the total number of bytes sent to the client.
-	BytesWritten() int
+	// Flushes returns the number of times the response was flushed.
+	Flushes() int
+	// FirstFlushAt returns the time of the first flush, or the zero time if
+	// the response has not been flushed.
+	FirstFlushAt() time.Time
+	// MaxFlushInterval returns the longest time between two flushes.
+	MaxFlushInterval() time.Duration
+	// Events returns the number of Server-Sent Events written if the
+	// response is a text/event-stream.
+	Events() int
+	// InformationalStatuses returns the 1xx status codes, such as 103 Early
+	// Hints, that were sent before the final status.
+	InformationalStatuses() []int
+	// BytesWritten returns the total number of bytes sent to the client. It
+	// is safe to call concurrently with writes, as are the flush and event
+	// counters.
+	BytesWritten() int64
+	// HeaderWrittenAt returns the time at which the response header was
+	// sent, or the zero time if it has not been sent yet.
+	HeaderWrittenAt() time.Time
+	// LastWriteAt returns the time at which the most recent body write
+	// completed, or the zero time if nothing has been written.
+	LastWriteAt() time.Time
+	// WriteError returns the first error returned by the proxied writer
+	// while sending the response body.
+	WriteError() error
+	// ErrorMessage returns the message written by http.Error, or an empty
+	// string if the response was not produced by http.Error.
+	ErrorMessage() string
+	// OnHeader registers a function that is called with the response header
+	// immediately before it is sent. Only one function can be registered:
+	// setting a second one will overwrite the first.
+	OnHeader(func(http.Header))
+	// OnHijack registers a function that may replace the connection and
+	// buffers returned by a successful call to Hijack. Only one function can
+	// be registered: setting a second one will overwrite the first.
+	OnHijack(func(net.Conn, *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter))
+	// Hijacked reports whether the handler took over the connection.
+	Hijacked() bool
+	// maybeWriteHeader sends the default 200 status if the handler has not
+	// sent a status yet.
+	maybeWriteHeader()
 	// Tee causes the response body to be written to the given io.Writer in
 	// addition to proxying the writes through. Only one io.Writer can be
 	// tee'd to at once: setting a second one will overwrite the first.
@@ -46,157 +89,342 @@ type writerProxy interface {
 	Tee(io.Writer)
 }
 
-// wrapWriter wraps an http.ResponseWriter, returning a proxy that allows you to
-// hook into various parts of the response process.
-func wrapWriter(w http.ResponseWriter, protoMajor int) writerProxy {
-	_, cn := w.(http.CloseNotifier) // nolint
-	_, fl := w.(http.Flusher)
-
-	bw := basicWriter{ResponseWriter: w}
+// Capability flags for the optional interfaces that an http.ResponseWriter
+// may implement.
+const (
+	capFlusher = 1 << iota
+	capHijacker
+	capReaderFrom
+	capPusher
+	capCloseNotifier
+	capStringWriter
+)
 
-	if protoMajor == 2 {
-		_, ps := w.(http.Pusher)
-		if cn && fl && ps {
-			return &http2FancyWriter{bw}
-		}
-	} else {
-		_, hj := w.(http.Hijacker)
-		_, rf := w.(io.ReaderFrom)
-		if cn && fl && hj && rf {
-			return &fancyWriter{bw}
-		}
+// capabilities reports the optional interfaces implemented by w as a mask of
+// capability flags.
+func capabilities(w http.ResponseWriter) int {
+	var mask = 0
+	if _, ok := w.(http.Flusher); ok {
+		mask |= capFlusher
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		mask |= capHijacker
+	}
+	if _, ok := w.(io.ReaderFrom); ok {
+		mask |= capReaderFrom
+	}
+	if _, ok := w.(http.Pusher); ok {
+		mask |= capPusher
 	}
-	if fl {
-		return &flushWriter{bw}
+	if _, ok := w.(http.CloseNotifier); ok { // nolint
+		mask |= capCloseNotifier
 	}
+	if _, ok := w.(io.StringWriter); ok {
+		mask |= capStringWriter
+	}
+	return mask
+}
 
-	return &bw
+// wrapWriter wraps an http.ResponseWriter, returning a proxy that allows you to
+// hook into various parts of the response process. The proxy implements the
+// same set of optional interfaces as the wrapped writer.
+func wrapWriter(w http.ResponseWriter) writerProxy {
+	var bw = &basicWriter{ResponseWriter: w}
+	return bw.withCapabilities(capabilities(w))
 }
 
 // basicWriter wraps a http.ResponseWriter that implements the minimal
 // http.ResponseWriter interface.
 type basicWriter struct {
 	http.ResponseWriter
-	wroteHeader bool
-	code        int
-	bytes       int
-	tee         io.Writer
+	wroteHeader   bool
+	code          int
+	bytes         int64
+	tee           io.Writer
+	httpError     bool
+	errorMessage  string
+	headerAt      time.Time
+	lastWriteAt   time.Time
+	onHeader      func(http.Header)
+	informational []int
+	onHijack      func(net.Conn, *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter)
+	hijacked      bool
+	flushes       int64
+	firstFlushAt  int64
+	lastFlushAt   int64
+	maxFlushGap   int64
+	eventStream   bool
+	lastByte      byte
+	events        int64
+	writeErr      error
 }
 
+// maxErrorMessage limits how much of an http.Error message is retained.
+const maxErrorMessage = 512
+
 func (b *basicWriter) WriteHeader(code int) {
+	if !b.wroteHeader && isInformational(code) {
+		// Informational responses may be sent any number of times before
+		// the final status and do not count as writing the header.
+		b.informational = append(b.informational, code)
+		b.ResponseWriter.WriteHeader(code)
+		return
+	}
 	if !b.wroteHeader {
+		b.beforeHeader()
 		b.code = code
 		b.wroteHeader = true
+		b.headerAt = time.Now()
+		b.httpError = isHTTPError(code, b.ResponseWriter.Header())
+		b.eventStream = isEventStream(b.ResponseWriter.Header())
 		b.ResponseWriter.WriteHeader(code)
 	}
 }
 func (b *basicWriter) Write(buf []byte) (int, error) {
 	b.WriteHeader(http.StatusOK)
 	n, err := b.ResponseWriter.Write(buf)
+	return n, b.wrote(buf[:n], err)
+}
+
+// wrote performs the bookkeeping for body bytes that were successfully sent
+// to the proxied writer. It returns the error that should be reported to the
+// caller.
+func (b *basicWriter) wrote(buf []byte, err error) error {
+	b.failed(err)
+	if b.httpError && b.errorMessage == "" {
+		b.errorMessage = strings.TrimSuffix(string(buf[:min(len(buf), maxErrorMessage)]), "\n")
+	}
 	if b.tee != nil {
-		_, err2 := b.tee.Write(buf[:n])
+		_, err2 := b.tee.Write(buf)
 		// Prefer errors generated by the proxied writer.
 		if err == nil {
 			err = err2
 		}
 	}
-	b.bytes += n
-	return n, err
+	if b.eventStream {
+		b.countEvents(buf)
+	}
+	atomic.AddInt64(&b.bytes, int64(len(buf)))
+	b.lastWriteAt = time.Now()
+	return err
+}
+
+// countEvents counts the blank lines that terminate Server-Sent Events. Line
+// endings may be LF or CRLF and may be split across writes.
+func (b *basicWriter) countEvents(buf []byte) {
+	for _, c := range buf {
+		switch c {
+		case '\r':
+			continue
+		case '\n':
+			if b.lastByte == '\n' {
+				atomic.AddInt64(&b.events, 1)
+				// Reset so that a run of blank lines is a single event.
+				c = 0
+			}
+		}
+		b.lastByte = c
+	}
+}
+
+// failed records the first error returned by the proxied writer.
+func (b *basicWriter) failed(err error) {
+	if err != nil && b.writeErr == nil {
+		b.writeErr = err
+	}
 }
 func (b *basicWriter) maybeWriteHeader() {
 	if !b.wroteHeader {
 		b.WriteHeader(http.StatusOK)
 	}
 }
+
+// beforeHeader runs the header hook, if any, exactly once.
+func (b *basicWriter) beforeHeader() {
+	if b.onHeader != nil {
+		var onHeader = b.onHeader
+		b.onHeader = nil
+		onHeader(b.ResponseWriter.Header())
+	}
+}
+
+// flushed sends the response header, as flushing the underlying writer
+// would, and records the flush.
+func (b *basicWriter) flushed() {
+	b.maybeWriteHeader()
+	var now = time.Now().UnixNano()
+	var previous = atomic.SwapInt64(&b.lastFlushAt, now)
+	if atomic.AddInt64(&b.flushes, 1) == 1 {
+		atomic.StoreInt64(&b.firstFlushAt, now)
+	} else if gap := now - previous; gap > atomic.LoadInt64(&b.maxFlushGap) {
+		atomic.StoreInt64(&b.maxFlushGap, gap)
+	}
+}
 func (b *basicWriter) Status() int {
 	if !b.wroteHeader {
 		return http.StatusOK
 	}
 	return b.code
 }
-func (b *basicWriter) BytesWritten() int {
-	return b.bytes
+func (b *basicWriter) InformationalStatuses() []int {
+	return b.informational
+}
+func (b *basicWriter) BytesWritten() int64 {
+	return atomic.LoadInt64(&b.bytes)
+}
+func (b *basicWriter) Flushes() int {
+	return int(atomic.LoadInt64(&b.flushes))
+}
+func (b *basicWriter) FirstFlushAt() time.Time {
+	if at := atomic.LoadInt64(&b.firstFlushAt); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+func (b *basicWriter) MaxFlushInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&b.maxFlushGap))
+}
+func (b *basicWriter) Events() int {
+	return int(atomic.LoadInt64(&b.events))
+}
+func (b *basicWriter) HeaderWrittenAt() time.Time {
+	return b.headerAt
+}
+func (b *basicWriter) LastWriteAt() time.Time {
+	return b.lastWriteAt
+}
+func (b *basicWriter) WriteError() error {
+	return b.writeErr
+}
+func (b *basicWriter) ErrorMessage() string {
+	return b.errorMessage
+}
+func (b *basicWriter) OnHeader(fn func(http.Header)) {
+	b.onHeader = fn
+}
+
+func (b *basicWriter) OnHijack(fn func(net.Conn, *bufio.ReadWriter) (net.Conn, *bufio.ReadWriter)) {
+	b.onHijack = fn
+}
+func (b *basicWriter) Hijacked() bool {
+	return b.hijacked
+}
+
+// Unwrap returns the proxied writer so that http.ResponseController can reach
+// methods, such as SetWriteDeadline, that the proxy does not implement.
+func (b *basicWriter) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
 }
 func (b *basicWriter) Tee(w io.Writer) {
 	b.tee = w
 }
 
-type flushWriter struct {
-	basicWriter
+// isInformational reports whether code is a 1xx status that precedes the
+// final status. 101 Switching Protocols is final because nothing follows it.
+func isInformational(code int) bool {
+	return code >= 100 && code < 200 && code != http.StatusSwitchingProtocols
 }
 
-func (f *flushWriter) Flush() {
-	f.wroteHeader = true
+// isEventStream reports whether the response is a Server-Sent Events stream.
+func isEventStream(header http.Header) bool {
+	var mediaType, _, _ = strings.Cut(header.Get("Content-Type"), ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream")
+}
 
-	fl := f.ResponseWriter.(http.Flusher)
-	fl.Flush()
+// isHTTPError reports whether a response header matches the one written by
+// http.Error immediately before it calls WriteHeader.
+func isHTTPError(code int, header http.Header) bool {
+	return code >= http.StatusBadRequest &&
+		header.Get("Content-Type") == "text/plain; charset=utf-8" &&
+		header.Get("X-Content-Type-Options") == "nosniff"
 }
 
-var _ http.Flusher = &flushWriter{}
+// flusher adapts a basicWriter to http.Flusher.
+type flusher struct {
+	*basicWriter
+}
 
-// fancyWriter is a HTTP writer that additionally satisfies http.CloseNotifier,
-// http.Flusher, http.Hijacker, and io.ReaderFrom. It exists for the common case
-// of wrapping the http.ResponseWriter that package http gives you, in order to
-// make the proxied object support the full method set of the proxied object.
-type fancyWriter struct {
-	basicWriter
+func (f flusher) Flush() {
+	f.flushed()
+	f.ResponseWriter.(http.Flusher).Flush()
 }
 
-func (f *fancyWriter) CloseNotify() <-chan bool {
-	cn := f.basicWriter.ResponseWriter.(http.CloseNotifier) // nolint
-	return cn.CloseNotify()
+// hijacker adapts a basicWriter to http.Hijacker.
+type hijacker struct {
+	*basicWriter
 }
-func (f *fancyWriter) Flush() {
-	f.wroteHeader = true
 
-	fl := f.ResponseWriter.(http.Flusher)
-	fl.Flush()
+func (h hijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := h.ResponseWriter.(http.Hijacker).Hijack()
+	if err != nil {
+		return conn, brw, err
+	}
+	h.hijacked = true
+	if h.onHijack != nil {
+		conn, brw = h.onHijack(conn, brw)
+	}
+	return conn, brw, nil
 }
-func (f *fancyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
-	hj := f.ResponseWriter.(http.Hijacker)
-	return hj.Hijack()
+
+// readerFrom adapts a basicWriter to io.ReaderFrom.
+type readerFrom struct {
+	*basicWriter
 }
-func (f *fancyWriter) ReadFrom(r io.Reader) (int64, error) {
-	if f.tee != nil {
-		n, err := io.Copy(&f.basicWriter, r)
-		f.bytes += int(n)
-		return n, err
-	}
-	rf := f.ResponseWriter.(io.ReaderFrom)
+
+func (f readerFrom) ReadFrom(r io.Reader) (int64, error) {
 	f.maybeWriteHeader()
-	n, err := rf.ReadFrom(r)
-	f.bytes += int(n)
+	if f.tee != nil || f.eventStream {
+		// Copying through the basicWriter keeps the tee'd writer and the
+		// event counter in sync. Bytes are counted by basicWriter.Write.
+		return io.Copy(f.basicWriter, r)
+	}
+	n, err := f.ResponseWriter.(io.ReaderFrom).ReadFrom(r)
+	f.failed(err)
+	atomic.AddInt64(&f.bytes, n)
+	f.lastWriteAt = time.Now()
 	return n, err
 }
 
-var _ http.CloseNotifier = &fancyWriter{} // nolint
-var _ http.Flusher = &fancyWriter{}
-var _ http.Hijacker = &fancyWriter{}
-var _ io.ReaderFrom = &fancyWriter{}
+// pusher adapts a basicWriter to http.Pusher.
+type pusher struct {
+	*basicWriter
+}
 
-// http2FancyWriter is a HTTP2 writer that additionally satisfies http.CloseNotifier,
-// http.Flusher, and io.ReaderFrom. It exists for the common case
-// of wrapping the http.ResponseWriter that package http gives you, in order to
-// make the proxied object support the full method set of the proxied object.
-type http2FancyWriter struct {
-	basicWriter
+func (p pusher) Push(target string, opts *http.PushOptions) error {
+	return p.ResponseWriter.(http.Pusher).Push(target, opts)
 }
 
-func (f *http2FancyWriter) CloseNotify() <-chan bool {
-	cn := f.basicWriter.ResponseWriter.(http.CloseNotifier) // nolint
-	return cn.CloseNotify()
+// closeNotifier adapts a basicWriter to http.CloseNotifier.
+type closeNotifier struct {
+	*basicWriter
 }
-func (f *http2FancyWriter) Flush() {
-	f.wroteHeader = true
 
-	fl := f.ResponseWriter.(http.Flusher)
-	fl.Flush()
+func (c closeNotifier) CloseNotify() <-chan bool {
+	return c.ResponseWriter.(http.CloseNotifier).CloseNotify() // nolint
 }
 
-func (f *http2FancyWriter) Push(target string, opts *http.PushOptions) error {
-	return f.basicWriter.ResponseWriter.(http.Pusher).Push(target, opts)
+// stringWriter adapts a basicWriter to io.StringWriter.
+type stringWriter struct {
+	*basicWriter
+}
+
+func (s stringWriter) WriteString(str string) (int, error) {
+	s.maybeWriteHeader()
+	if s.tee != nil || s.httpError || s.eventStream {
+		// The bookkeeping needs the bytes so there is nothing to gain from
+		// the proxied WriteString.
+		return s.basicWriter.Write([]byte(str))
+	}
+	n, err := s.ResponseWriter.(io.StringWriter).WriteString(str)
+	s.failed(err)
+	atomic.AddInt64(&s.bytes, int64(n))
+	s.lastWriteAt = time.Now()
+	return n, err
 }
 
-var _ http.CloseNotifier = &http2FancyWriter{} // nolint
-var _ http.Flusher = &http2FancyWriter{}
-var _ http.Pusher = &http2FancyWriter{}
+var _ http.Flusher = flusher{}
+var _ http.Hijacker = hijacker{}
+var _ io.ReaderFrom = readerFrom{}
+var _ http.Pusher = pusher{}
+var _ http.CloseNotifier = closeNotifier{} // nolint
+var _ io.StringWriter = stringWriter{}
@@ -0,0 +1,464 @@
+package httplog
+
+import (
+	"io"
+	"net/http"
+)
+
+// withCapabilities returns a proxy around the basicWriter that implements
+// exactly the optional interfaces selected by the capability mask. Every
+// combination is listed so that wrapping never hides an interface that the
+// underlying http.ResponseWriter supports. Each optional interface is
+// satisfied by a small adapter type that shares the same basicWriter.
+func (b *basicWriter) withCapabilities(mask int) writerProxy {
+	switch mask {
+	case 0:
+		return b
+	case capFlusher:
+		return struct {
+			*basicWriter
+			http.Flusher
+		}{b, flusher{b}}
+	case capHijacker:
+		return struct {
+			*basicWriter
+			http.Hijacker
+		}{b, hijacker{b}}
+	case capFlusher | capHijacker:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+		}{b, flusher{b}, hijacker{b}}
+	case capReaderFrom:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+		}{b, readerFrom{b}}
+	case capFlusher | capReaderFrom:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+		}{b, flusher{b}, readerFrom{b}}
+	case capHijacker | capReaderFrom:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+		}{b, hijacker{b}, readerFrom{b}}
+	case capFlusher | capHijacker | capReaderFrom:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}}
+	case capPusher:
+		return struct {
+			*basicWriter
+			http.Pusher
+		}{b, pusher{b}}
+	case capFlusher | capPusher:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Pusher
+		}{b, flusher{b}, pusher{b}}
+	case capHijacker | capPusher:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.Pusher
+		}{b, hijacker{b}, pusher{b}}
+	case capFlusher | capHijacker | capPusher:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{b, flusher{b}, hijacker{b}, pusher{b}}
+	case capReaderFrom | capPusher:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.Pusher
+		}{b, readerFrom{b}, pusher{b}}
+	case capFlusher | capReaderFrom | capPusher:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+		}{b, flusher{b}, readerFrom{b}, pusher{b}}
+	case capHijacker | capReaderFrom | capPusher:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{b, hijacker{b}, readerFrom{b}, pusher{b}}
+	case capFlusher | capHijacker | capReaderFrom | capPusher:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, pusher{b}}
+	case capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.CloseNotifier // nolint
+		}{b, closeNotifier{b}}
+	case capFlusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, closeNotifier{b}}
+	case capHijacker | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.CloseNotifier // nolint
+		}{b, hijacker{b}, closeNotifier{b}}
+	case capFlusher | capHijacker | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, hijacker{b}, closeNotifier{b}}
+	case capReaderFrom | capCloseNotifier:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+		}{b, readerFrom{b}, closeNotifier{b}}
+	case capFlusher | capReaderFrom | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, readerFrom{b}, closeNotifier{b}}
+	case capHijacker | capReaderFrom | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+		}{b, hijacker{b}, readerFrom{b}, closeNotifier{b}}
+	case capFlusher | capHijacker | capReaderFrom | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, closeNotifier{b}}
+	case capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, pusher{b}, closeNotifier{b}}
+	case capFlusher | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, pusher{b}, closeNotifier{b}}
+	case capHijacker | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, hijacker{b}, pusher{b}, closeNotifier{b}}
+	case capFlusher | capHijacker | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, hijacker{b}, pusher{b}, closeNotifier{b}}
+	case capReaderFrom | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, readerFrom{b}, pusher{b}, closeNotifier{b}}
+	case capFlusher | capReaderFrom | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, readerFrom{b}, pusher{b}, closeNotifier{b}}
+	case capHijacker | capReaderFrom | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, hijacker{b}, readerFrom{b}, pusher{b}, closeNotifier{b}}
+	case capFlusher | capHijacker | capReaderFrom | capPusher | capCloseNotifier:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, pusher{b}, closeNotifier{b}}
+	case capStringWriter:
+		return struct {
+			*basicWriter
+			io.StringWriter
+		}{b, stringWriter{b}}
+	case capFlusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.StringWriter
+		}{b, flusher{b}, stringWriter{b}}
+	case capHijacker | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.StringWriter
+		}{b, hijacker{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, stringWriter{b}}
+	case capReaderFrom | capStringWriter:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			io.StringWriter
+		}{b, readerFrom{b}, stringWriter{b}}
+	case capFlusher | capReaderFrom | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			io.StringWriter
+		}{b, flusher{b}, readerFrom{b}, stringWriter{b}}
+	case capHijacker | capReaderFrom | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{b, hijacker{b}, readerFrom{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capReaderFrom | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, stringWriter{b}}
+	case capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Pusher
+			io.StringWriter
+		}{b, pusher{b}, stringWriter{b}}
+	case capFlusher | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Pusher
+			io.StringWriter
+		}{b, flusher{b}, pusher{b}, stringWriter{b}}
+	case capHijacker | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{b, hijacker{b}, pusher{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, pusher{b}, stringWriter{b}}
+	case capReaderFrom | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{b, readerFrom{b}, pusher{b}, stringWriter{b}}
+	case capFlusher | capReaderFrom | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{b, flusher{b}, readerFrom{b}, pusher{b}, stringWriter{b}}
+	case capHijacker | capReaderFrom | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{b, hijacker{b}, readerFrom{b}, pusher{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capReaderFrom | capPusher | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, pusher{b}, stringWriter{b}}
+	case capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capHijacker | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, hijacker{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, closeNotifier{b}, stringWriter{b}}
+	case capReaderFrom | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, readerFrom{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capReaderFrom | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, readerFrom{b}, closeNotifier{b}, stringWriter{b}}
+	case capHijacker | capReaderFrom | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, hijacker{b}, readerFrom{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capReaderFrom | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, closeNotifier{b}, stringWriter{b}}
+	case capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capHijacker | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, hijacker{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capReaderFrom | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, readerFrom{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capReaderFrom | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, readerFrom{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capHijacker | capReaderFrom | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, hijacker{b}, readerFrom{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	case capFlusher | capHijacker | capReaderFrom | capPusher | capCloseNotifier | capStringWriter:
+		return struct {
+			*basicWriter
+			http.Flusher
+			http.Hijacker
+			io.ReaderFrom
+			http.Pusher
+			http.CloseNotifier // nolint
+			io.StringWriter
+		}{b, flusher{b}, hijacker{b}, readerFrom{b}, pusher{b}, closeNotifier{b}, stringWriter{b}}
+	default:
+		return b
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"testing"
+	"time"
 )
 
 type fixtureResponseWriter struct {
@@ -82,16 +84,17 @@ func (r *fixtureHTTPResponseWriter) ReadFrom(reader io.Reader) (n int64, err err
 }
 
 func TestRespWrapperInterfaces(t *testing.T) {
-	var _ http.CloseNotifier = &fancyWriter{} // nolint
-	var _ http.Flusher = &fancyWriter{}
-	var _ http.Hijacker = &fancyWriter{}
-	var _ io.ReaderFrom = &fancyWriter{}
-	var _ http.Flusher = &flushWriter{}
+	var _ http.CloseNotifier = closeNotifier{} // nolint
+	var _ http.Flusher = flusher{}
+	var _ http.Hijacker = hijacker{}
+	var _ io.ReaderFrom = readerFrom{}
+	var _ http.Pusher = pusher{}
+	var _ io.StringWriter = stringWriter{}
 }
 
 func TestSimpleImplementationOnlyGetsBasic(t *testing.T) {
 	var r = fixtureResponseWriter{}
-	var result = wrapWriter(&r, 1)
+	var result = wrapWriter(&r)
 
 	if _, ok := result.(http.ResponseWriter); !ok {
 		t.Fatal("Did not get a ResponseWriter back.")
@@ -103,7 +106,7 @@ func TestSimpleImplementationOnlyGetsBasic(t *testing.T) {
 
 func TestFlusherOnlyGetsFlusher(t *testing.T) {
 	var r = fixtureFlusher{fixtureResponseWriter{}, false}
-	var result = wrapWriter(&r, 1)
+	var result = wrapWriter(&r)
 
 	if _, ok := result.(http.ResponseWriter); !ok {
 		t.Fatal("Did not get a ResponseWriter back.")
@@ -111,8 +114,8 @@ func TestFlusherOnlyGetsFlusher(t *testing.T) {
 	if _, ok := result.(http.Flusher); !ok {
 		t.Fatal("Did not get a flusher back.")
 	}
-	if _, ok := result.(*flushWriter); !ok {
-		t.Fatalf("Did not wrap a flusher with a flushWiter. %s", reflect.TypeOf(result))
+	if mask := capabilities(result); mask != capFlusher {
+		t.Fatalf("Wrapping a flusher added capabilities %b. %s", mask, reflect.TypeOf(result))
 	}
 }
 
@@ -126,7 +129,7 @@ func TestFullFeaturedGetsFancy(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var result = wrapWriter(&r, 1)
+	var result = wrapWriter(&r)
 
 	if _, ok := result.(http.ResponseWriter); !ok {
 		t.Fatal("Did not get a ResponseWriter back.")
@@ -140,8 +143,11 @@ func TestFullFeaturedGetsFancy(t *testing.T) {
 	if _, ok := result.(io.ReaderFrom); !ok {
 		t.Fatal("Did not get a ReaderFrom back.")
 	}
-	if _, ok := result.(*fancyWriter); !ok {
-		t.Fatalf("Did not wrap a full implementation with a fancyWriter. %s", reflect.TypeOf(result))
+	if _, ok := result.(http.Pusher); !ok {
+		t.Fatal("Did not get a Pusher back.")
+	}
+	if _, ok := result.(http.Flusher); !ok {
+		t.Fatal("Did not get a Flusher back.")
 	}
 }
 
@@ -213,7 +219,7 @@ func TestFancyWriterCloseNotify(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 1)
+	var r = wrapWriter(&wrapped)
 
 	r.(http.CloseNotifier).CloseNotify() // nolint
 	if !wrapped.calledCloseNotify {
@@ -231,7 +237,7 @@ func TestFancyWriter2CloseNotify(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 2)
+	var r = wrapWriter(&wrapped)
 	r.(http.CloseNotifier).CloseNotify() // nolint
 	if !wrapped.calledCloseNotify {
 		t.Fatal("Wrapper did not called wrapped implementation.")
@@ -248,7 +254,7 @@ func TestFancyWriterHijacker(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 1)
+	var r = wrapWriter(&wrapped)
 
 	_, _, _ = r.(http.Hijacker).Hijack()
 	if !wrapped.calledHijack {
@@ -266,7 +272,7 @@ func TestFancyWriterFlush(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 1)
+	var r = wrapWriter(&wrapped)
 
 	r.(http.Flusher).Flush()
 	if !wrapped.calledFlush {
@@ -284,7 +290,7 @@ func TestFancyWriter2Flush(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 2)
+	var r = wrapWriter(&wrapped)
 
 	r.(http.Flusher).Flush()
 	if !wrapped.calledFlush {
@@ -302,7 +308,7 @@ func TestFancyWriterReaderFrom(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 1)
+	var r = wrapWriter(&wrapped)
 	_, _ = r.(io.ReaderFrom).ReadFrom(bytes.NewBufferString(`TEST`))
 	if !wrapped.calledReadFrom {
 		t.Fatal("Wrapper did not called wrapped implementation.")
@@ -322,7 +328,7 @@ func TestFancyWriter2Push(t *testing.T) {
 		fixturePusher{base, false},
 		false,
 	}
-	var r = wrapWriter(&wrapped, 2)
+	var r = wrapWriter(&wrapped)
 
 	_ = r.(http.Pusher).Push("", nil)
 	if !wrapped.calledPush {
@@ -332,10 +338,240 @@ func TestFancyWriter2Push(t *testing.T) {
 
 func TestFlushWriterFlush(t *testing.T) {
 	var wrapped = fixtureFlusher{fixtureResponseWriter{}, false}
-	var r = wrapWriter(&wrapped, 2)
+	var r = wrapWriter(&wrapped)
 
 	r.(http.Flusher).Flush()
 	if !wrapped.calledFlush {
 		t.Fatal("Wrapper did not called wrapped implementation.")
 	}
 }
+
+func TestBasicWriterCapturesHTTPErrorMessage(t *testing.T) {
+	var recorder = httptest.NewRecorder()
+	var r = basicWriter{ResponseWriter: recorder}
+
+	http.Error(&r, "failed", http.StatusInternalServerError)
+	if r.ErrorMessage() != "failed" {
+		t.Fatalf("Expected http.Error message to be captured. Got %q", r.ErrorMessage())
+	}
+
+	recorder = httptest.NewRecorder()
+	r = basicWriter{ResponseWriter: recorder}
+	r.WriteHeader(http.StatusInternalServerError)
+	_, _ = r.Write([]byte(`{"error": "failed"}`))
+	if r.ErrorMessage() != "" {
+		t.Fatalf("Expected only http.Error messages to be captured. Got %q", r.ErrorMessage())
+	}
+}
+
+type fixtureFullResponseWriter struct {
+	fixtureResponseWriter
+	called map[string]bool
+}
+
+func (r *fixtureFullResponseWriter) Flush() {
+	r.called["Flush"] = true
+}
+func (r *fixtureFullResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	r.called["Hijack"] = true
+	return nil, nil, nil
+}
+func (r *fixtureFullResponseWriter) ReadFrom(reader io.Reader) (int64, error) {
+	r.called["ReadFrom"] = true
+	return io.Copy(io.Discard, reader)
+}
+func (r *fixtureFullResponseWriter) Push(target string, opts *http.PushOptions) error {
+	r.called["Push"] = true
+	return nil
+}
+func (r *fixtureFullResponseWriter) CloseNotify() <-chan bool {
+	r.called["CloseNotify"] = true
+	return make(<-chan bool)
+}
+func (r *fixtureFullResponseWriter) WriteString(s string) (int, error) {
+	r.called["WriteString"] = true
+	return len(s), nil
+}
+
+func TestWrapWriterCapabilityMatrix(t *testing.T) {
+	var calls = []struct {
+		capability int
+		name       string
+		call       func(http.ResponseWriter)
+	}{
+		{capFlusher, "Flush", func(w http.ResponseWriter) { w.(http.Flusher).Flush() }},
+		{capHijacker, "Hijack", func(w http.ResponseWriter) { _, _, _ = w.(http.Hijacker).Hijack() }},
+		{capReaderFrom, "ReadFrom", func(w http.ResponseWriter) { _, _ = w.(io.ReaderFrom).ReadFrom(bytes.NewBufferString(`TEST`)) }},
+		{capPusher, "Push", func(w http.ResponseWriter) { _ = w.(http.Pusher).Push("/", nil) }},
+		{capCloseNotifier, "CloseNotify", func(w http.ResponseWriter) { w.(http.CloseNotifier).CloseNotify() }}, // nolint
+		{capStringWriter, "WriteString", func(w http.ResponseWriter) { _, _ = w.(io.StringWriter).WriteString(`TEST`) }},
+	}
+	for mask := 0; mask < capStringWriter<<1; mask = mask + 1 {
+		var full = &fixtureFullResponseWriter{called: make(map[string]bool)}
+		// Build a writer that implements exactly the interfaces in the mask
+		// by restricting a full implementation.
+		var fixture = (&basicWriter{ResponseWriter: full}).withCapabilities(mask)
+		if actual := capabilities(fixture); actual != mask {
+			t.Fatalf("Fixture for mask %06b implements %06b. %s", mask, actual, reflect.TypeOf(fixture))
+		}
+		var result = wrapWriter(fixture)
+		if actual := capabilities(result); actual != mask {
+			t.Fatalf("Wrapping mask %06b produced %06b. %s", mask, actual, reflect.TypeOf(result))
+		}
+		if _, ok := result.(writerProxy); !ok {
+			t.Fatalf("Wrapping mask %06b did not produce a writerProxy.", mask)
+		}
+		for _, c := range calls {
+			if mask&c.capability == 0 {
+				continue
+			}
+			c.call(result)
+			if !full.called[c.name] {
+				t.Fatalf("Wrapping mask %06b did not pass %s through to the wrapped writer.", mask, c.name)
+			}
+		}
+	}
+}
+
+func TestReaderFromCountsTeeBytesOnce(t *testing.T) {
+	var full = &fixtureFullResponseWriter{called: make(map[string]bool)}
+	var r = wrapWriter(full)
+	var tee = &bytes.Buffer{}
+	r.Tee(tee)
+
+	_, _ = r.(io.ReaderFrom).ReadFrom(bytes.NewBufferString(`TEST`))
+	if r.BytesWritten() != 4 {
+		t.Fatalf("Expected 4 bytes written. Got %d", r.BytesWritten())
+	}
+	if tee.String() != `TEST` {
+		t.Fatalf("Expected tee to receive the body. Got %q", tee.String())
+	}
+}
+
+func TestStringWriterCountsBytesWritten(t *testing.T) {
+	var full = &fixtureFullResponseWriter{called: make(map[string]bool)}
+	var r = wrapWriter(full)
+
+	_, _ = r.(io.StringWriter).WriteString(`TEST`)
+	if r.BytesWritten() != 4 {
+		t.Fatalf("Expected 4 bytes written. Got %d", r.BytesWritten())
+	}
+	if !full.calledWriteHeader || !full.called["WriteString"] {
+		t.Fatal("Wrapper did not called wrapped implementation.")
+	}
+}
+
+type fixtureControllableResponseWriter struct {
+	fixtureFlusher
+	calledSetReadDeadline   bool
+	calledSetWriteDeadline  bool
+	calledEnableFullDuplex  bool
+	expectedDeadline        time.Time
+	receivedUnexpectedValue bool
+}
+
+func (r *fixtureControllableResponseWriter) SetReadDeadline(deadline time.Time) error {
+	r.calledSetReadDeadline = true
+	r.receivedUnexpectedValue = r.receivedUnexpectedValue || !deadline.Equal(r.expectedDeadline)
+	return nil
+}
+func (r *fixtureControllableResponseWriter) SetWriteDeadline(deadline time.Time) error {
+	r.calledSetWriteDeadline = true
+	r.receivedUnexpectedValue = r.receivedUnexpectedValue || !deadline.Equal(r.expectedDeadline)
+	return nil
+}
+func (r *fixtureControllableResponseWriter) EnableFullDuplex() error {
+	r.calledEnableFullDuplex = true
+	return nil
+}
+
+func TestResponseControllerReachesWrappedWriter(t *testing.T) {
+	var deadline = time.Now().Add(time.Minute)
+	var wrapped = &fixtureControllableResponseWriter{expectedDeadline: deadline}
+	var rc = http.NewResponseController(wrapWriter(wrapped))
+
+	if err := rc.SetReadDeadline(deadline); err != nil {
+		t.Fatalf("SetReadDeadline failed: %s", err)
+	}
+	if err := rc.SetWriteDeadline(deadline); err != nil {
+		t.Fatalf("SetWriteDeadline failed: %s", err)
+	}
+	if err := rc.EnableFullDuplex(); err != nil {
+		t.Fatalf("EnableFullDuplex failed: %s", err)
+	}
+	if err := rc.Flush(); err != nil {
+		t.Fatalf("Flush failed: %s", err)
+	}
+	if !wrapped.calledSetReadDeadline || !wrapped.calledSetWriteDeadline || !wrapped.calledEnableFullDuplex || !wrapped.calledFlush {
+		t.Fatal("ResponseController did not reach the wrapped implementation.")
+	}
+	if wrapped.receivedUnexpectedValue {
+		t.Fatal("ResponseController passed the wrong deadline to the wrapped implementation.")
+	}
+}
+
+func TestResponseControllerWithServer(t *testing.T) {
+	var errs = make(chan error, 4)
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var rc = http.NewResponseController(wrapWriter(w))
+		errs <- rc.SetReadDeadline(time.Now().Add(time.Minute))
+		errs <- rc.SetWriteDeadline(time.Now().Add(time.Minute))
+		errs <- rc.EnableFullDuplex()
+		errs <- rc.Flush()
+	}))
+	defer server.Close()
+
+	var resp, err = http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	for i := 0; i < 4; i = i + 1 {
+		if err := <-errs; err != nil {
+			t.Fatalf("ResponseController call %d failed: %s", i, err)
+		}
+	}
+}
+
+func TestBasicWriterTracksInformationalStatuses(t *testing.T) {
+	var wrapped = &fixtureResponseWriter{}
+	var r = basicWriter{ResponseWriter: wrapped}
+
+	r.WriteHeader(http.StatusContinue)
+	r.WriteHeader(http.StatusEarlyHints)
+	if !wrapped.calledWriteHeader {
+		t.Fatal("Wrapper did not send informational status to wrapped implementation.")
+	}
+	r.WriteHeader(http.StatusCreated)
+	if r.Status() != http.StatusCreated {
+		t.Fatalf("Expected code to be 201 but got %d", r.Status())
+	}
+	if !reflect.DeepEqual(r.InformationalStatuses(), []int{http.StatusContinue, http.StatusEarlyHints}) {
+		t.Fatalf("Unexpected informational statuses %v", r.InformationalStatuses())
+	}
+}
+
+func TestBasicWriterSwitchingProtocolsIsFinal(t *testing.T) {
+	var r = basicWriter{ResponseWriter: &fixtureResponseWriter{}}
+
+	r.WriteHeader(http.StatusSwitchingProtocols)
+	r.WriteHeader(http.StatusOK)
+	if r.Status() != http.StatusSwitchingProtocols {
+		t.Fatalf("Expected code to be 101 but got %d", r.Status())
+	}
+	if len(r.InformationalStatuses()) != 0 {
+		t.Fatalf("Unexpected informational statuses %v", r.InformationalStatuses())
+	}
+}
+
+func TestFlushSendsDefaultStatus(t *testing.T) {
+	var r = wrapWriter(&fixtureFlusher{})
+
+	r.(http.Flusher).Flush()
+	if r.Status() != http.StatusOK {
+		t.Fatalf("Expected code to be 200 but got %d", r.Status())
+	}
+	if r.Flushes() != 1 || r.FirstFlushAt().IsZero() {
+		t.Fatal("Flush was not recorded.")
+	}
+}
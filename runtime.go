@@ -0,0 +1,224 @@
+package httplog
+
+import (
+	"context"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// Sources of a configuration change reported in the source field of a
+// ConfigChange event.
+const (
+	ConfigSourceAPI    = "api"
+	ConfigSourceFile   = "file"
+	ConfigSourceSignal = "signal"
+	ConfigSourceAdmin  = "admin"
+)
+
+// Runtime holds a middleware configuration that can be replaced while the
+// service is running. Requests that are in flight when a new configuration is
+// applied finish with the configuration they started with.
+type Runtime struct {
+	logger   logevent.Logger
+	hostname string
+	static   []MiddlewareOption
+	lock     sync.Mutex
+	config   atomic.Pointer[Config]
+	current  atomic.Pointer[Middleware]
+}
+
+// NewRuntime creates a Runtime from the initial configuration. Every change
+// is audited with a ConfigChange event emitted to the given logger. The
+// options are applied after those of each configuration and so are never
+// changed by a reload. They are the place for options that cannot be
+// expressed in a Config, such as MiddlewareOptionTagFunc.
+func NewRuntime(conf *Config, logger logevent.Logger, options ...MiddlewareOption) (*Runtime, error) {
+	var hostname, _ = os.Hostname()
+	var rt = &Runtime{
+		logger:   logger,
+		hostname: hostname,
+		static:   options,
+	}
+	var m, err = rt.build(conf)
+	if err != nil {
+		return nil, err
+	}
+	rt.config.Store(conf)
+	rt.current.Store(m)
+	return rt, nil
+}
+
+// Middleware returns a handler wrapper that logs each request with the
+// configuration current when the request arrives.
+func (rt *Runtime) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rt.current.Load().serve(w, r, next)
+		})
+	}
+}
+
+// Config returns the configuration currently applied. It must not be
+// modified.
+func (rt *Runtime) Config() *Config {
+	return rt.config.Load()
+}
+
+// Apply validates the configuration and, if it is valid, makes it the current
+// configuration. An invalid configuration leaves the current one in place and
+// the validation error is returned.
+func (rt *Runtime) Apply(conf *Config) error {
+	return rt.apply(conf, ConfigSourceAPI)
+}
+
+// apply swaps in the configuration and emits an audit event describing the
+// change, or the reason it was rejected.
+func (rt *Runtime) apply(conf *Config, source string) error {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	return rt.swap(conf, source)
+}
+
+// update applies a copy of the current configuration modified by change. The
+// copy is taken under the lock so that concurrent updates are not lost.
+func (rt *Runtime) update(source string, change func(*Config)) error {
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	var conf = cloneConfig(rt.config.Load())
+	change(conf)
+	return rt.swap(conf, source)
+}
+
+// cloneConfig copies the slices and maps of the configuration as well so that
+// changes to the copy never reach the configuration in use.
+func cloneConfig(conf *Config) *Config {
+	var clone = *conf
+	clone.BaseProviders = slices.Clone(conf.BaseProviders)
+	clone.Tags = maps.Clone(conf.Tags)
+	clone.RedactParameters = slices.Clone(conf.RedactParameters)
+	clone.RequestHeaders = slices.Clone(conf.RequestHeaders)
+	clone.Trailers = slices.Clone(conf.Trailers)
+	clone.DebugRoutes = slices.Clone(conf.DebugRoutes)
+	clone.QueueTrusted = slices.Clone(conf.QueueTrusted)
+	return &clone
+}
+
+// swap must be called with the lock held.
+func (rt *Runtime) swap(conf *Config, source string) error {
+	var previous = rt.current.Load()
+	var m, err = rt.build(conf)
+	if err != nil {
+		rt.reject(source, err)
+		return err
+	}
+	rt.config.Store(conf)
+	rt.current.Store(m)
+	rt.logger.Info(configChange(previous, m, source))
+	return nil
+}
+
+// reject emits an audit event for a configuration that could not be loaded.
+func (rt *Runtime) reject(source string, err error) {
+	rt.logger.Error(ConfigChange{Base: rt.current.Load().base(), Source: source, Error: err.Error()})
+}
+
+func (rt *Runtime) build(conf *Config) (*Middleware, error) {
+	var options, err = conf.Options()
+	if err != nil {
+		return nil, err
+	}
+	return newMiddleware(rt.hostname, nil, append(options, rt.static...)...), nil
+}
+
+// WatchFile polls the file every interval and applies its configuration
+// whenever its size or modification time changes. Files that fail to load are
+// audited and leave the current configuration in place. It blocks until the
+// context is cancelled.
+func (rt *Runtime) WatchFile(ctx context.Context, path string, interval time.Duration) {
+	var ticker = time.NewTicker(interval)
+	defer ticker.Stop()
+	var last, _ = os.Stat(path)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		var info, err = os.Stat(path)
+		if err != nil || (last != nil && info.ModTime().Equal(last.ModTime()) && info.Size() == last.Size()) {
+			continue
+		}
+		last = info
+		var conf *Config
+		if conf, err = LoadConfigFromFile(path); err != nil {
+			rt.reject(ConfigSourceFile, err)
+			continue
+		}
+		_ = rt.apply(conf, ConfigSourceFile)
+	}
+}
+
+// ReloadOnSignal calls load and applies the configuration it returns each
+// time the process receives one of the signals, or SIGHUP if none are given.
+// It blocks until the context is cancelled.
+func (rt *Runtime) ReloadOnSignal(ctx context.Context, load func() (*Config, error), signals ...os.Signal) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGHUP}
+	}
+	var received = make(chan os.Signal, 1)
+	signal.Notify(received, signals...)
+	defer signal.Stop(received)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-received:
+		}
+		var conf, err = load()
+		if err != nil {
+			rt.reject(ConfigSourceSignal, err)
+			continue
+		}
+		_ = rt.apply(conf, ConfigSourceSignal)
+	}
+}
+
+// configChange describes the difference between two configurations. Secrets
+// are masked in the same way as in the startup lifecycle event.
+func configChange(previous *Middleware, current *Middleware, source string) ConfigChange {
+	var before = middlewareConfig(previous)
+	var after = middlewareConfig(current)
+	var event = ConfigChange{
+		Base:     current.base(),
+		Source:   source,
+		Changed:  []string{},
+		Previous: map[string]string{},
+		Current:  map[string]string{},
+	}
+	for key, value := range after {
+		if old, ok := before[key]; !ok || old != value {
+			event.Changed = append(event.Changed, key)
+			event.Previous[key] = before[key]
+			event.Current[key] = value
+		}
+	}
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			event.Changed = append(event.Changed, key)
+			event.Previous[key] = value
+			event.Current[key] = ""
+		}
+	}
+	sort.Strings(event.Changed)
+	return event
+}
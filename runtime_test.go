@@ -0,0 +1,152 @@
+package httplog
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func TestRuntimeApply(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var conf = NewConfig()
+	conf.Service = "test"
+	var rt, err = NewRuntime(conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var handler = rt.Middleware()(fixtureHandler{})
+
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		if evt := event.(Access); evt.URIQuery != "token=abc" {
+			t.Fatalf("unexpected query %q", evt.URIQuery)
+		}
+	})
+	var req = newLevelRequest(logger)
+	req.URL.RawQuery = "token=abc"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var next = NewConfig()
+	next.Service = "test"
+	next.RedactParameters = []string{"token"}
+	next.Level = LevelDebug
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt, ok = event.(ConfigChange)
+		if !ok {
+			t.Fatalf("expected a ConfigChange event but got %T", event)
+		}
+		if len(evt.Changed) != 2 || evt.Changed[0] != "level" || evt.Changed[1] != "redacted" {
+			t.Fatalf("unexpected changes %v", evt.Changed)
+		}
+		if evt.Previous["level"] != LevelInfo || evt.Current["level"] != LevelDebug || evt.Source != ConfigSourceAPI {
+			t.Fatalf("unexpected change event, %v", evt)
+		}
+	})
+	if err = rt.Apply(next); err != nil {
+		t.Fatal(err)
+	}
+	logger.EXPECT().Debug(gomock.Any()).Do(func(event interface{}) {
+		if evt := event.(Access); evt.URIQuery != "token=REDACTED" {
+			t.Fatalf("reloaded redaction was not applied, %q", evt.URIQuery)
+		}
+	})
+	req = newLevelRequest(logger)
+	req.URL.RawQuery = "token=abc"
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var invalid = NewConfig()
+	invalid.SampleRate = -1
+	logger.EXPECT().Error(gomock.Any()).Do(func(event interface{}) {
+		if evt := event.(ConfigChange); evt.Error == "" {
+			t.Fatalf("rejected change did not record the error, %v", evt)
+		}
+	})
+	if err = rt.Apply(invalid); err == nil {
+		t.Fatal("expected an invalid configuration to be rejected")
+	}
+	if rt.Config() != next {
+		t.Fatal("rejected configuration replaced the current one")
+	}
+}
+
+func TestRuntimeUpdateCopiesConfig(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var conf = NewConfig()
+	conf.Tags = map[string]string{"team": "payments"}
+	conf.DebugRoutes = []string{"/orders"}
+	var rt, err = NewRuntime(conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.EXPECT().Info(gomock.Any())
+	err = rt.update(ConfigSourceAdmin, func(next *Config) {
+		next.Tags["team"] = "billing"
+		next.DebugRoutes[0] = "/invoices"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Tags["team"] != "payments" || conf.DebugRoutes[0] != "/orders" {
+		t.Fatalf("update modified the previous configuration, %v", conf)
+	}
+	if next := rt.Config(); next.Tags["team"] != "billing" || next.DebugRoutes[0] != "/invoices" {
+		t.Fatalf("update was not applied, %v", next)
+	}
+}
+
+func TestRuntimeWatchFile(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var path = filepath.Join(t.TempDir(), "httplog.json")
+	if err := os.WriteFile(path, []byte(`{"service": "test"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var conf, _ = LoadConfigFromFile(path)
+	var rt, err = NewRuntime(conf, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var changed = make(chan ConfigChange, 1)
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		select {
+		case changed <- event.(ConfigChange):
+		default:
+		}
+	}).MinTimes(1)
+	var ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	go rt.WatchFile(ctx, path, 10*time.Millisecond)
+
+	// The watcher may not have recorded the original file yet so the change is
+	// written until it is noticed.
+	var evt ConfigChange
+	for waiting := true; waiting; {
+		if err = os.WriteFile(path, []byte(`{"service": "test", "sample_rate": 0.5}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case evt = <-changed:
+			waiting = false
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+	if evt.Source != ConfigSourceFile || evt.Current["sample_rate"] != "0.5" {
+		t.Fatalf("unexpected change event, %v", evt)
+	}
+	if rt.Config().SampleRate != 0.5 {
+		t.Fatalf("file change was not applied, %+v", rt.Config())
+	}
+}
@@ -0,0 +1,72 @@
+package httplog
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// serverTimingTotal is the name of the Server-Timing segment that reports the
+// time the handler spent before sending the response header.
+const serverTimingTotal = "app"
+
+// AddServerTiming records a named duration, such as time spent in a database
+// or cache, for the request bound to the context. Durations are reported in
+// the timings field of the access log in milliseconds and, when enabled with
+// MiddlewareOptionServerTiming, in the Server-Timing response header.
+// Repeated names are summed. Names should be valid HTTP tokens. Only segments
+// added before the response header is sent can appear in the header.
+func AddServerTiming(ctx context.Context, name string, d time.Duration) {
+	if record := accessRecordFromContext(ctx); record != nil {
+		record.update(func(a *Access) {
+			if a.Timings == nil {
+				a.Timings = make(map[string]float64)
+			}
+			a.Timings[name] = a.Timings[name] + float64(d.Microseconds())/1e3
+		})
+	}
+}
+
+// MiddlewareOptionServerTiming enables the Server-Timing response header. The
+// header contains every segment added with AddServerTiming before the
+// response header was sent along with an "app" segment that reports the time
+// the handler took to begin its response.
+func MiddlewareOptionServerTiming() MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.serverTiming = true
+		return m
+	}
+}
+
+// serverTiming renders the Server-Timing header value for the segments
+// recorded so far.
+func (a *accessRecord) serverTiming(elapsed time.Duration) string {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	var names = make([]string, 0, len(a.access.Timings))
+	for name := range a.access.Timings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var segments = make([]string, 0, len(names)+1)
+	for _, name := range names {
+		segments = append(segments, formatServerTiming(name, a.access.Timings[name]))
+	}
+	segments = append(segments, formatServerTiming(serverTimingTotal, float64(elapsed.Microseconds())/1e3))
+	return strings.Join(segments, ", ")
+}
+
+func formatServerTiming(name string, milliseconds float64) string {
+	return name + ";dur=" + strconv.FormatFloat(milliseconds, 'f', -1, 64)
+}
+
+// addServerTimingHeader installs the hook that writes the Server-Timing header
+// immediately before the response header is sent.
+func addServerTimingHeader(wrapper writerProxy, record *accessRecord, start time.Time) {
+	wrapper.OnHeader(func(header http.Header) {
+		header.Add("Server-Timing", record.serverTiming(time.Since(start)))
+	})
+}
@@ -0,0 +1,91 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureHandlerServerTiming struct{}
+
+func (fixtureHandlerServerTiming) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	AddServerTiming(r.Context(), "db", 5*time.Millisecond)
+	AddServerTiming(r.Context(), "cache", 250*time.Microsecond)
+	AddServerTiming(r.Context(), "db", 2*time.Millisecond)
+	_, _ = w.Write([]byte(`done`))
+	AddServerTiming(r.Context(), "upstream", time.Millisecond)
+}
+
+func TestMiddlewareOptionServerTiming(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware(MiddlewareOptionServerTiming())(fixtureHandlerServerTiming{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+	var recorder = httptest.NewRecorder()
+
+	logger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		var evt = event.(Access)
+		var expected = map[string]float64{"db": 7, "cache": 0.25, "upstream": 1}
+		for name, duration := range expected {
+			if evt.Timings[name] != duration {
+				t.Fatalf("expected %s timing of %v but got %v", name, duration, evt.Timings)
+			}
+		}
+	})
+	m.ServeHTTP(recorder, req)
+
+	var header = recorder.Header().Get("Server-Timing")
+	if !strings.HasPrefix(header, "cache;dur=0.25, db;dur=7, app;dur=") {
+		t.Fatalf("unexpected Server-Timing header %q", header)
+	}
+	if strings.Contains(header, "upstream") {
+		t.Fatalf("Server-Timing header contains a segment added after the header was sent %q", header)
+	}
+}
+
+func TestServerTimingWithoutWrite(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any())
+	var m = NewMiddleware(MiddlewareOptionServerTiming())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddServerTiming(r.Context(), "db", 2*time.Millisecond)
+	}))
+	var recorder = httptest.NewRecorder()
+	m.ServeHTTP(recorder, newLevelRequest(logger))
+	if header := recorder.Header().Get("Server-Timing"); !strings.HasPrefix(header, "db;dur=2, app;dur=") {
+		t.Fatalf("unexpected Server-Timing header %q", header)
+	}
+}
+
+func TestServerTimingDisabledByDefault(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware()(fixtureHandlerServerTiming{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+	var recorder = httptest.NewRecorder()
+
+	logger.EXPECT().Info(gomock.Any())
+	m.ServeHTTP(recorder, req)
+	if header := recorder.Header().Get("Server-Timing"); header != "" {
+		t.Fatalf("unexpected Server-Timing header %q", header)
+	}
+}
@@ -0,0 +1,91 @@
+package httplog
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// heartbeatMessage is the message of in-progress access logs.
+const heartbeatMessage = "heartbeat"
+
+// MiddlewareOptionHeartbeat emits an in-progress access log at the given
+// interval for as long as a request is being handled. This gives visibility
+// into long lived responses, such as Server-Sent Events, that would otherwise
+// only be logged once they finish. Heartbeats have an in_progress field set to
+// true and a message of "heartbeat". The status and response headers are not final so
+// they are not included. Heartbeats are emitted at the level of the access log
+// and only for requests kept by sampling.
+func MiddlewareOptionHeartbeat(interval time.Duration) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.heartbeat = interval
+		return m
+	}
+}
+
+// startHeartbeat emits heartbeats until the returned function is called. The
+// function may be called more than once so that it can also be deferred in
+// case the handler panics.
+func (m *Middleware) startHeartbeat(r *http.Request, record *accessRecord, wrapper writerProxy, bodyWrapper *recordingReader, start time.Time, kept bool) func() {
+	if m.heartbeat <= 0 {
+		return func() {}
+	}
+	var ticker = time.NewTicker(m.heartbeat)
+	var stop = make(chan struct{})
+	var stopped = make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				var access, fields = record.snapshot()
+				fillProgress(&access, fields, wrapper, bodyWrapper, start)
+				fields["in_progress"] = true
+				access.Message = heartbeatMessage
+				if !m.sampled(access, kept) {
+					continue
+				}
+				// Response tags are applied to a copy so that their values,
+				// computed without a final status, do not leak into the
+				// logger shared with the handler.
+				var logger = logevent.FromContext(r.Context())
+				if len(m.responseTags) > 0 {
+					logger = logger.Copy()
+				}
+				m.logAccess(logger, r, nil, access, fields)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ticker.Stop()
+			close(stop)
+			<-stopped
+		})
+	}
+}
+
+// fillProgress sets the access log fields that may be safely read while
+// the handler is still writing the response. The flush and event fields are
+// only added for responses that were flushed or sent events.
+func fillProgress(a *Access, fields map[string]interface{}, wrapper writerProxy, bodyWrapper *recordingReader, start time.Time) {
+	var elapsed = time.Since(start)
+	a.Duration = int(elapsed.Nanoseconds() / 1e6)
+	a.DurationMicros = int(elapsed.Microseconds())
+	a.BytesOut = wrapper.BytesWritten()
+	a.BytesIn = bodyWrapper.BytesRead()
+	a.Bytes = a.BytesIn + a.BytesOut
+	if flushes := wrapper.Flushes(); flushes > 0 {
+		fields["flushes"] = flushes
+		fields["first_flush_us"] = int(wrapper.FirstFlushAt().Sub(start).Microseconds())
+		fields["max_flush_interval_us"] = int(wrapper.MaxFlushInterval().Microseconds())
+	}
+	if events := wrapper.Events(); events > 0 {
+		fields["sse_events"] = events
+	}
+}
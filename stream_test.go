@@ -0,0 +1,201 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureHandlerEventStream struct {
+	delay time.Duration
+}
+
+func (h fixtureHandlerEventStream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+	for _, event := range []string{"data: one\n\n", "event: two\r\ndata: 2\r\n", "\r\n", "data: three\n\n\n"} {
+		_, _ = io.WriteString(w, event)
+		w.(http.Flusher).Flush()
+		time.Sleep(h.delay)
+	}
+}
+
+// loggedAccess is an access log along with the fields set on the copy of the
+// logger that emitted it.
+type loggedAccess struct {
+	access Access
+	fields map[string]interface{}
+}
+
+// expectAccessLogs collects the access logs emitted at the given level
+// through copies of the logger, such as those of heartbeats.
+func expectAccessLogs(ctrl *gomock.Controller, logger *MockLogger, level string) func() []loggedAccess {
+	var lock sync.Mutex
+	var logs []loggedAccess
+	logger.EXPECT().Copy().DoAndReturn(func() logevent.Logger {
+		var copied = NewMockLogger(ctrl)
+		var logged = loggedAccess{fields: make(map[string]interface{})}
+		copied.EXPECT().SetField(gomock.Any(), gomock.Any()).Do(func(name string, value interface{}) {
+			logged.fields[name] = value
+		}).AnyTimes()
+		var emit = func(event interface{}) {
+			lock.Lock()
+			defer lock.Unlock()
+			logged.access = event.(Access)
+			logs = append(logs, logged)
+		}
+		switch level {
+		case LevelWarn:
+			copied.EXPECT().Warn(gomock.Any()).Do(emit)
+		default:
+			copied.EXPECT().Info(gomock.Any()).Do(emit)
+		}
+		return copied
+	}).AnyTimes()
+	return func() []loggedAccess {
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]loggedAccess(nil), logs...)
+	}
+}
+
+func TestMiddlewareEventStream(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var delay = 5 * time.Millisecond
+	var logger = NewMockLogger(ctrl)
+	var logs = expectAccessLogs(ctrl, logger, LevelInfo)
+
+	var m = NewMiddleware(MiddlewareOptionHeartbeat(delay))(fixtureHandlerEventStream{delay: delay}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+	m.ServeHTTP(httptest.NewRecorder(), req)
+
+	var events = logs()
+	if len(events) < 2 {
+		t.Fatalf("expected at least one heartbeat before the access log, got %d events", len(events))
+	}
+	for _, heartbeat := range events[:len(events)-1] {
+		if heartbeat.fields["in_progress"] != true || heartbeat.access.Message != heartbeatMessage {
+			t.Fatalf("expected a heartbeat, %v %v", heartbeat.access, heartbeat.fields)
+		}
+	}
+	var final = events[len(events)-1].fields
+	if final["in_progress"] != nil {
+		t.Fatalf("final access log marked in progress, %v", final)
+	}
+	if final["flushes"] != 4 || final["sse_events"] != 3 {
+		t.Fatalf("unexpected stream counters, %v", final)
+	}
+	var maxInterval, _ = final["max_flush_interval_us"].(int)
+	var firstFlush, _ = final["first_flush_us"].(int)
+	if maxInterval < int(delay.Microseconds()) {
+		t.Fatalf("flush interval not recorded, %v", final)
+	}
+	if firstFlush > maxInterval {
+		t.Fatalf("first flush recorded after the stream gaps, %v", final)
+	}
+}
+
+func TestMiddlewareHeartbeatSampling(t *testing.T) {
+	var tc = []struct {
+		name       string
+		draw       float64
+		heartbeats bool
+	}{
+		{"kept", 0.1, true},
+		{"sampled out", 0.9, false},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var ctrl = gomock.NewController(t)
+			defer ctrl.Finish()
+
+			var delay = 5 * time.Millisecond
+			var logger = NewMockLogger(ctrl)
+			var logs = expectAccessLogs(ctrl, logger, LevelWarn)
+
+			var m = NewMiddleware(
+				MiddlewareOptionHeartbeat(delay),
+				MiddlewareOptionSampleRate(0.5),
+				MiddlewareOptionLevel(LevelWarn, LevelError),
+			)(fixtureHandlerEventStream{delay: delay}).(*Middleware)
+			m.sample = func() float64 { return c.draw }
+			var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+			req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+			req = req.WithContext(logevent.NewContext(req.Context(), logger))
+			m.ServeHTTP(httptest.NewRecorder(), req)
+
+			var events = logs()
+			if c.heartbeats && (len(events) < 2 || events[0].fields["in_progress"] != true) {
+				t.Fatalf("expected heartbeats at the configured level, got %d events", len(events))
+			}
+			if !c.heartbeats && len(events) != 0 {
+				t.Fatalf("expected no logs for a sampled out stream but got %d", len(events))
+			}
+		})
+	}
+}
+
+func TestMiddlewareHeartbeatServerTiming(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// Heartbeats read the timings while the handler is still adding to them.
+	var readTimings = func(event interface{}) {
+		var total float64
+		for _, value := range event.(Access).Timings {
+			total = total + value
+		}
+	}
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Copy().DoAndReturn(func() logevent.Logger {
+		var copied = NewMockLogger(ctrl)
+		copied.EXPECT().SetField(gomock.Any(), gomock.Any()).AnyTimes()
+		copied.EXPECT().Info(gomock.Any()).Do(readTimings)
+		return copied
+	}).AnyTimes()
+	logger.EXPECT().Info(gomock.Any()).Do(readTimings).AnyTimes()
+
+	var m = NewMiddleware(MiddlewareOptionHeartbeat(time.Millisecond))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deadline = time.Now().Add(20 * time.Millisecond)
+		for x := 0; time.Now().Before(deadline); x = x + 1 {
+			AddServerTiming(r.Context(), "db"+strconv.Itoa(x), time.Microsecond)
+			time.Sleep(10 * time.Microsecond)
+		}
+	}))
+	m.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+}
+
+func TestMiddlewareHeartbeatStopsOnPanic(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var logs = expectAccessLogs(ctrl, logger, LevelInfo)
+
+	var m = NewMiddleware(MiddlewareOptionHeartbeat(time.Millisecond))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		panic(http.ErrAbortHandler)
+	}))
+	func() {
+		defer func() { _ = recover() }()
+		m.ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+	}()
+	var after = len(logs())
+	time.Sleep(10 * time.Millisecond)
+	if actual := len(logs()); actual != after {
+		t.Fatalf("heartbeats continued after the handler panicked, %d then %d", after, actual)
+	}
+}
@@ -0,0 +1,302 @@
+package httplog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+)
+
+// tailEntry is a record published to the subscribers of a Tail along with
+// the attributes used to filter it.
+type tailEntry struct {
+	kind      string
+	status    int
+	route     string
+	method    string
+	requestID string
+	duration  time.Duration
+	record    interface{}
+}
+
+type statusRange struct {
+	min int
+	max int
+}
+
+// tailFilter selects the records sent to a subscriber. Empty criteria match
+// every record.
+type tailFilter struct {
+	statuses    []statusRange
+	route       string
+	method      string
+	requestID   string
+	minDuration time.Duration
+}
+
+// parseTailFilter reads the filter from the query parameters status, route,
+// method, min_duration, and request_id. Status is a comma separated list of
+// codes or classes such as 5xx.
+func parseTailFilter(query url.Values) (tailFilter, error) {
+	var filter = tailFilter{
+		route:     query.Get("route"),
+		method:    strings.ToUpper(query.Get("method")),
+		requestID: query.Get("request_id"),
+	}
+	for _, value := range splitList(query.Get("status")) {
+		if len(value) == 3 && strings.HasSuffix(strings.ToLower(value), "xx") && value[0] >= '1' && value[0] <= '5' {
+			var class = int(value[0]-'0') * 100
+			filter.statuses = append(filter.statuses, statusRange{min: class, max: class + 99})
+			continue
+		}
+		var code, err = strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("status: %q is not a status code or class", value)
+		}
+		filter.statuses = append(filter.statuses, statusRange{min: code, max: code})
+	}
+	if value := query.Get("min_duration"); value != "" {
+		var duration, err = time.ParseDuration(value)
+		if err != nil {
+			return filter, fmt.Errorf("min_duration: %w", err)
+		}
+		filter.minDuration = duration
+	}
+	return filter, nil
+}
+
+// match reports whether the entry passes the filter. The minimum duration
+// only applies to access records because events are logged before the
+// request completes.
+func (f tailFilter) match(e *tailEntry) bool {
+	if f.route != "" && f.route != e.route {
+		return false
+	}
+	if f.method != "" && f.method != e.method {
+		return false
+	}
+	if f.requestID != "" && f.requestID != e.requestID {
+		return false
+	}
+	if f.minDuration > 0 && (e.kind != "access" || e.duration < f.minDuration) {
+		return false
+	}
+	if len(f.statuses) == 0 {
+		return true
+	}
+	for _, status := range f.statuses {
+		if e.status >= status.min && e.status <= status.max {
+			return true
+		}
+	}
+	return false
+}
+
+// tailSubscriber receives the encoded records that match its filter. Records
+// that arrive while its buffer is full are dropped and counted.
+type tailSubscriber struct {
+	filter   tailFilter
+	messages chan []byte
+	dropped  int64
+}
+
+// Tail streams access records and events to viewers as Server-Sent Events.
+// Each viewer has a bounded buffer and records are dropped for a viewer that
+// falls behind so that request handling is never blocked. The viewer is told
+// how many records were dropped with a dropped event. Install the Tail with
+// MiddlewareOptionTail and mount it as a handler:
+//
+//	var tail = httplog.NewTail(100, authorize)
+//	var handler = httplog.NewMiddleware(httplog.MiddlewareOptionTail(tail))(mux)
+//	adminMux.Handle("/tail", tail)
+//
+// Viewers select records with the status, route, method, min_duration, and
+// request_id query parameters, for example /tail?status=5xx&min_duration=1s.
+type Tail struct {
+	lock        sync.RWMutex
+	subscribers map[*tailSubscriber]struct{}
+	viewers     int64
+	buffer      int
+	authorize   Authorizer
+}
+
+// NewTail creates a Tail that buffers up to buffer records for each viewer.
+// Viewers must be allowed by the authorizer. A nil authorizer denies every
+// viewer.
+func NewTail(buffer int, authorize Authorizer) *Tail {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Tail{
+		subscribers: make(map[*tailSubscriber]struct{}),
+		buffer:      buffer,
+		authorize:   authorize,
+	}
+}
+
+// MiddlewareOptionTail publishes every access record, whether or not it was
+// sampled out, and every Event logged through the request logger to the
+// viewers of the Tail.
+func MiddlewareOptionTail(t *Tail) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.tail = t
+		return m
+	}
+}
+
+func (t *Tail) subscribe(filter tailFilter) *tailSubscriber {
+	var sub = &tailSubscriber{filter: filter, messages: make(chan []byte, t.buffer)}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.subscribers[sub] = struct{}{}
+	atomic.AddInt64(&t.viewers, 1)
+	return sub
+}
+
+func (t *Tail) unsubscribe(sub *tailSubscriber) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.subscribers, sub)
+	atomic.AddInt64(&t.viewers, -1)
+}
+
+// publish sends the entry to every matching subscriber without blocking. The
+// record is encoded before the lock is taken, and only when there is a
+// viewer, so that requests are not slowed down while nobody is watching. A
+// record that cannot be encoded is counted as dropped.
+func (t *Tail) publish(e tailEntry) {
+	if atomic.LoadInt64(&t.viewers) == 0 {
+		return
+	}
+	var message []byte
+	if data, err := json.Marshal(recordFields(e.record)); err == nil {
+		message = []byte("event: " + e.kind + "\ndata: " + string(data) + "\n\n")
+	}
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	for sub := range t.subscribers {
+		if !sub.filter.match(&e) {
+			continue
+		}
+		if message == nil {
+			atomic.AddInt64(&sub.dropped, 1)
+			continue
+		}
+		select {
+		case sub.messages <- message:
+		default:
+			atomic.AddInt64(&sub.dropped, 1)
+		}
+	}
+}
+
+func (t *Tail) publishAccess(a Access) {
+	t.publish(tailEntry{
+		kind:      "access",
+		status:    a.Status,
+		route:     a.Route,
+		method:    a.HTTPMethod,
+		requestID: a.RequestID,
+		duration:  time.Duration(a.DurationMicros) * time.Microsecond,
+		record:    a,
+	})
+}
+
+func (t *Tail) publishEvent(record *accessRecord, event eventEmbedder) {
+	var a, _ = record.snapshot()
+	t.publish(tailEntry{
+		kind:      "event",
+		status:    event.EventRecord().Status,
+		route:     a.Route,
+		method:    a.HTTPMethod,
+		requestID: a.RequestID,
+		record:    event,
+	})
+}
+
+// ServeHTTP streams the matching records until the viewer disconnects.
+func (t *Tail) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if t.authorize == nil || !t.authorize(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+	var filter, err = parseTailFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var sub = t.subscribe(filter)
+	defer t.unsubscribe(sub)
+
+	var controller = http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err = controller.Flush(); err != nil {
+		return
+	}
+	for {
+		var message []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case message = <-sub.messages:
+		}
+		if dropped := atomic.SwapInt64(&sub.dropped, 0); dropped > 0 {
+			if _, err = fmt.Fprintf(w, "event: dropped\ndata: %d\n\n", dropped); err != nil {
+				return
+			}
+		}
+		if _, err = w.Write(message); err != nil {
+			return
+		}
+		if err = controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// tailLogger publishes the Events, and structs that embed Event, logged
+// during a request to the Tail before passing them on.
+type tailLogger struct {
+	logevent.Logger
+	tail   *Tail
+	record *accessRecord
+}
+
+func (l *tailLogger) publish(event interface{}) {
+	if evt, ok := event.(eventEmbedder); ok {
+		l.tail.publishEvent(l.record, evt)
+	}
+}
+
+func (l *tailLogger) Debug(event interface{}) {
+	l.publish(event)
+	l.Logger.Debug(event)
+}
+
+func (l *tailLogger) Info(event interface{}) {
+	l.publish(event)
+	l.Logger.Info(event)
+}
+
+func (l *tailLogger) Warn(event interface{}) {
+	l.publish(event)
+	l.Logger.Warn(event)
+}
+
+func (l *tailLogger) Error(event interface{}) {
+	l.publish(event)
+	l.Logger.Error(event)
+}
+
+func (l *tailLogger) Copy() logevent.Logger {
+	return &tailLogger{Logger: l.Logger.Copy(), tail: l.tail, record: l.record}
+}
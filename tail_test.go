@@ -0,0 +1,181 @@
+package httplog
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+func TestTailFilter(t *testing.T) {
+	var entry = tailEntry{kind: "access", status: 503, route: "/users/{id}", method: "GET", requestID: "abc", duration: time.Second}
+	var tests = []struct {
+		query string
+		match bool
+	}{
+		{"", true},
+		{"status=5xx", true},
+		{"status=404,500", false},
+		{"status=503&method=get&route=/users/{id}&request_id=abc", true},
+		{"method=POST", false},
+		{"min_duration=500ms", true},
+		{"min_duration=2s", false},
+	}
+	for _, tt := range tests {
+		var query, _ = url.ParseQuery(tt.query)
+		var filter, err = parseTailFilter(query)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.query, err)
+		}
+		if filter.match(&entry) != tt.match {
+			t.Fatalf("%s: expected match %v", tt.query, tt.match)
+		}
+	}
+	for _, query := range []string{"status=bad", "status=6xx", "min_duration=soon"} {
+		var values, _ = url.ParseQuery(query)
+		if _, err := parseTailFilter(values); err == nil {
+			t.Fatalf("%s: expected an error", query)
+		}
+	}
+}
+
+func TestTailDropsForSlowViewers(t *testing.T) {
+	var tail = NewTail(1, nil)
+	var sub = tail.subscribe(tailFilter{})
+	defer tail.unsubscribe(sub)
+	for x := 0; x < 3; x = x + 1 {
+		tail.publishAccess(Access{Status: 200})
+	}
+	if len(sub.messages) != 1 || sub.dropped != 2 {
+		t.Fatalf("expected 1 buffered and 2 dropped records but got %d and %d", len(sub.messages), sub.dropped)
+	}
+}
+
+func TestTailDropsUnencodableRecords(t *testing.T) {
+	var tail = NewTail(10, nil)
+	var sub = tail.subscribe(tailFilter{})
+	defer tail.unsubscribe(sub)
+	tail.publish(tailEntry{kind: "event", record: struct {
+		Value chan int `logevent:"value"`
+	}{Value: make(chan int)}})
+	if len(sub.messages) != 0 || sub.dropped != 1 {
+		t.Fatalf("expected the record to be dropped but got %d buffered and %d dropped", len(sub.messages), sub.dropped)
+	}
+}
+
+func TestTailPublishesSampledOutRecords(t *testing.T) {
+	var tail = NewTail(10, nil)
+	var sub = tail.subscribe(tailFilter{})
+	defer tail.unsubscribe(sub)
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var m = NewMiddleware(MiddlewareOptionTail(tail), MiddlewareOptionSampleRate(0))
+	m(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+	if len(sub.messages) != 1 {
+		t.Fatalf("expected the sampled out record to be published but got %d records", len(sub.messages))
+	}
+}
+
+type fixtureTailEvent struct {
+	Event
+	Region string `logevent:"region"`
+}
+
+func TestTailPublishesEmbeddedEvents(t *testing.T) {
+	var tail = NewTail(10, nil)
+	var sub = tail.subscribe(tailFilter{})
+	defer tail.unsubscribe(sub)
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any()).Times(3)
+	var m = NewMiddleware(MiddlewareOptionTail(tail))
+	m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logevent.FromContext(r.Context()).Info(NewEvent(r.Context()))
+		logevent.FromContext(r.Context()).Info(fixtureTailEvent{Event: NewEvent(r.Context()), Region: "us-east-1"})
+	})).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+	if len(sub.messages) != 3 {
+		t.Fatalf("expected 3 records but got %d", len(sub.messages))
+	}
+	<-sub.messages
+	if message := string(<-sub.messages); !strings.HasPrefix(message, "event: event") || !strings.Contains(message, `"region":"us-east-1"`) {
+		t.Fatalf("unexpected record %s", message)
+	}
+}
+
+func TestTailRequiresAuthorizer(t *testing.T) {
+	var tc = []struct {
+		name      string
+		authorize Authorizer
+	}{
+		{"nil", nil},
+		{"denied", func(*http.Request) bool { return false }},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var w = httptest.NewRecorder()
+			NewTail(10, c.authorize).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+			if w.Code != http.StatusForbidden {
+				t.Fatalf("expected the viewer to be forbidden but got %d", w.Code)
+			}
+		})
+	}
+}
+
+func TestTailStreamsMatchingRecords(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	logger.EXPECT().Info(gomock.Any()).Times(3)
+	var tail = NewTail(10, func(*http.Request) bool { return true })
+	var server = httptest.NewServer(tail)
+	defer server.Close()
+
+	var resp, err = http.Get(server.URL + "?status=5xx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	var m = NewMiddleware(MiddlewareOptionTail(tail))
+	m(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+	m(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event = NewEvent(r.Context())
+		event.Status = http.StatusBadGateway
+		event.Action = "proxy"
+		logevent.FromContext(r.Context()).Info(event)
+		w.WriteHeader(http.StatusBadGateway)
+	})).ServeHTTP(httptest.NewRecorder(), newLevelRequest(logger))
+
+	var reader = bufio.NewReader(resp.Body)
+	var kinds []string
+	for len(kinds) < 2 {
+		var line, err = reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kind, ok := strings.CutPrefix(strings.TrimSpace(line), "event: "); ok {
+			kinds = append(kinds, kind)
+			continue
+		}
+		if data, ok := strings.CutPrefix(line, "data: "); ok && !strings.Contains(data, `"status":502`) {
+			t.Fatalf("unexpected record %s", data)
+		}
+	}
+	if kinds[0] != "event" || kinds[1] != "access" {
+		t.Fatalf("unexpected records %v", kinds)
+	}
+}
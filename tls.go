@@ -0,0 +1,63 @@
+package httplog
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+)
+
+// TLSVerbosity controls how much detail about the TLS connection of a request
+// is recorded in the access log.
+type TLSVerbosity int
+
+const (
+	// TLSVerbosityNone records nothing about the TLS connection.
+	TLSVerbosityNone TLSVerbosity = iota
+	// TLSVerbosityBasic records the TLS version and cipher suite. This is the
+	// default.
+	TLSVerbosityBasic
+	// TLSVerbosityConnection adds the SNI server name, the negotiated ALPN
+	// protocol, and whether the session was resumed.
+	TLSVerbosityConnection
+	// TLSVerbosityClientCertificate adds the subject, issuer, serial number,
+	// and SHA-256 fingerprint of the client certificate presented for mTLS.
+	TLSVerbosityClientCertificate
+)
+
+// MiddlewareOptionTLSVerbosity sets how much detail about the TLS connection
+// is recorded in the access log. The default is TLSVerbosityBasic.
+func MiddlewareOptionTLSVerbosity(verbosity TLSVerbosity) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.tlsVerbosity = verbosity
+		return m
+	}
+}
+
+// tlsFields returns the TLS details of the connection allowed by the
+// verbosity, keyed by their access log field names. Requests received over
+// plain HTTP have none so that their access logs carry no empty TLS fields.
+func tlsFields(state *tls.ConnectionState, verbosity TLSVerbosity) map[string]interface{} {
+	if state == nil || verbosity <= TLSVerbosityNone {
+		return nil
+	}
+	var fields = map[string]interface{}{
+		"tls_version":      tls.VersionName(state.Version),
+		"tls_cipher_suite": tls.CipherSuiteName(state.CipherSuite),
+	}
+	if verbosity < TLSVerbosityConnection {
+		return fields
+	}
+	fields["tls_server_name"] = state.ServerName
+	fields["tls_alpn"] = state.NegotiatedProtocol
+	fields["tls_resumed"] = state.DidResume
+	if verbosity < TLSVerbosityClientCertificate || len(state.PeerCertificates) == 0 {
+		return fields
+	}
+	var cert = state.PeerCertificates[0]
+	var fingerprint = sha256.Sum256(cert.Raw)
+	fields["tls_client_subject"] = cert.Subject.String()
+	fields["tls_client_issuer"] = cert.Issuer.String()
+	fields["tls_client_serial"] = cert.SerialNumber.Text(16)
+	fields["tls_client_fingerprint"] = hex.EncodeToString(fingerprint[:])
+	return fields
+}
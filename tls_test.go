@@ -0,0 +1,108 @@
+package httplog
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+)
+
+func fixtureCertificate(t *testing.T) *x509.Certificate {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var template = &x509.Certificate{
+		SerialNumber: big.NewInt(0xbeef),
+		Subject:      pkix.Name{CommonName: "client"},
+		Issuer:       pkix.Name{CommonName: "client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	var raw []byte
+	if raw, err = x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key); err != nil {
+		t.Fatal(err)
+	}
+	var cert *x509.Certificate
+	if cert, err = x509.ParseCertificate(raw); err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestTLSFields(t *testing.T) {
+	var cert = fixtureCertificate(t)
+	var fingerprint = sha256.Sum256(cert.Raw)
+	var state = &tls.ConnectionState{
+		Version:            tls.VersionTLS13,
+		CipherSuite:        tls.TLS_AES_128_GCM_SHA256,
+		ServerName:         "example.com",
+		NegotiatedProtocol: "h2",
+		DidResume:          true,
+		PeerCertificates:   []*x509.Certificate{cert},
+	}
+	var basic = map[string]interface{}{"tls_version": "TLS 1.3", "tls_cipher_suite": "TLS_AES_128_GCM_SHA256"}
+	var connection = map[string]interface{}{"tls_server_name": "example.com", "tls_alpn": "h2", "tls_resumed": true}
+	var client = map[string]interface{}{
+		"tls_client_subject":     "CN=client",
+		"tls_client_issuer":      "CN=client",
+		"tls_client_serial":      "beef",
+		"tls_client_fingerprint": hex.EncodeToString(fingerprint[:]),
+	}
+	var merge = func(parts ...map[string]interface{}) map[string]interface{} {
+		var fields = make(map[string]interface{})
+		for _, part := range parts {
+			for key, value := range part {
+				fields[key] = value
+			}
+		}
+		return fields
+	}
+
+	var tc = []struct {
+		name      string
+		state     *tls.ConnectionState
+		verbosity TLSVerbosity
+		expected  map[string]interface{}
+	}{
+		{"plain http", nil, TLSVerbosityClientCertificate, nil},
+		{"none", state, TLSVerbosityNone, nil},
+		{"basic", state, TLSVerbosityBasic, basic},
+		{"connection", state, TLSVerbosityConnection, merge(basic, connection)},
+		{"client certificate", state, TLSVerbosityClientCertificate, merge(basic, connection, client)},
+	}
+	for _, c := range tc {
+		t.Run(c.name, func(t *testing.T) {
+			var actual = tlsFields(c.state, c.verbosity)
+			if !reflect.DeepEqual(actual, c.expected) {
+				t.Fatalf("expected %v but got %v", c.expected, actual)
+			}
+		})
+	}
+}
+
+func TestMiddlewareTLSFields(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var accessLogger = NewMockLogger(ctrl)
+	var req = newLevelRequest(logger)
+	req.TLS = &tls.ConnectionState{Version: tls.VersionTLS12, CipherSuite: tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}
+	logger.EXPECT().Copy().Return(accessLogger)
+	accessLogger.EXPECT().SetField("tls_version", "TLS 1.2")
+	accessLogger.EXPECT().SetField("tls_cipher_suite", "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	accessLogger.EXPECT().Info(gomock.Any())
+	NewMiddleware()(fixtureHandler{}).ServeHTTP(httptest.NewRecorder(), req)
+}
@@ -0,0 +1,49 @@
+package httplog
+
+import (
+	"net/http"
+	"strings"
+)
+
+// MiddlewareOptionTrailer records the value of the named response trailers,
+// such as grpc-status or a checksum, in the trailers field of the access log.
+// Both trailers declared with the Trailer header and those set using the
+// http.TrailerPrefix convention are captured.
+func MiddlewareOptionTrailer(names ...string) MiddlewareOption {
+	return func(m *Middleware) *Middleware {
+		m.trailers = append(m.trailers, names...)
+		return m
+	}
+}
+
+// captureTrailers returns the values of the named trailers found in the
+// response header after the handler has returned.
+func captureTrailers(names []string, header http.Header) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	var trailers = make(map[string]string, len(names))
+	for _, name := range names {
+		if value := header.Get(http.TrailerPrefix + name); value != "" {
+			trailers[name] = value
+			continue
+		}
+		if isDeclaredTrailer(header, name) {
+			if value := header.Get(name); value != "" {
+				trailers[name] = value
+			}
+		}
+	}
+	return trailers
+}
+
+func isDeclaredTrailer(header http.Header, name string) bool {
+	for _, declared := range header.Values("Trailer") {
+		for _, field := range strings.Split(declared, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
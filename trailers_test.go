@@ -0,0 +1,54 @@
+package httplog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/asecurityteam/logevent/v2"
+	"github.com/golang/mock/gomock"
+)
+
+type fixtureHandlerTrailers struct{}
+
+func (fixtureHandlerTrailers) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+	w.Header().Set("Link", "</style.css>; rel=preload; as=style")
+	w.WriteHeader(http.StatusEarlyHints)
+	_, _ = w.Write([]byte(`body`))
+	w.Header().Set("Grpc-Status", "0")
+	w.Header().Set(http.TrailerPrefix+"Checksum", "abc123")
+	w.Header().Set("Undeclared", "value")
+}
+
+func TestMiddlewareOptionTrailer(t *testing.T) {
+	var ctrl = gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var logger = NewMockLogger(ctrl)
+	var result = NewMiddleware(MiddlewareOptionTrailer("Grpc-Status", "Grpc-Message", "Checksum", "Undeclared"))
+	var m = result(fixtureHandlerTrailers{}).(*Middleware)
+	var req = httptest.NewRequest(http.MethodGet, "/", io.NopCloser(bytes.NewBufferString(``)))
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.IPAddr{Zone: "", IP: net.ParseIP("127.0.0.1")}))
+	req = req.WithContext(logevent.NewContext(req.Context(), logger))
+
+	var accessLogger, fields = expectAccessFields(ctrl, logger)
+	accessLogger.EXPECT().Info(gomock.Any()).Do(func(event interface{}) {
+		if evt := event.(Access); evt.Status != http.StatusOK {
+			t.Fatalf("informational status was logged as the final status, %v", evt)
+		}
+	})
+	m.ServeHTTP(httptest.NewRecorder(), req)
+	var expected = map[string]string{"Grpc-Status": "0", "Checksum": "abc123"}
+	if !reflect.DeepEqual(fields["trailers"], expected) {
+		t.Fatalf("expected trailers %v but got %v", expected, fields["trailers"])
+	}
+	if !reflect.DeepEqual(fields["informational_statuses"], []int{http.StatusEarlyHints}) {
+		t.Fatalf("informational status was not logged, %v", fields)
+	}
+}